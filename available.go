@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// AvailabilityResponse is the body of GET /api/available/{alias}
+type AvailabilityResponse struct {
+	Alias     string `json:"alias"`
+	Available bool   `json:"available"`
+}
+
+// checkAliasAvailable handles GET /api/available/{alias} requests
+// It reports whether a custom alias is free without reading the whole item
+func checkAliasAvailable(ctx context.Context, request events.APIGatewayProxyRequest, alias string) (events.APIGatewayProxyResponse, error) {
+	if err := validateCustomAlias(alias); err != nil {
+		return errorResponse(400, "invalid custom alias"), nil
+	}
+
+	tenant := requestTenant(request)
+	taken, err := caseVariantTaken(ctx, tenant, alias)
+	if err != nil {
+		return errorResponse(500, "Error querying DynamoDB"), err
+	}
+	if taken {
+		return jsonResponse(200, AvailabilityResponse{Alias: alias, Available: false})
+	}
+
+	key, err := shortURLKey(mappingKey(tenant, canonicalCode(alias)))
+	if err != nil {
+		return errorResponse(500, "Error creating key"), err
+	}
+
+	// Projecting just the key keeps this read as cheap as possible
+	result, err := ddbClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            &tableName,
+		Key:                  key,
+		ProjectionExpression: aws.String("short_url"),
+	})
+	if err != nil {
+		return errorResponse(500, "Error querying DynamoDB"), err
+	}
+
+	return jsonResponse(200, AvailabilityResponse{
+		Alias:     alias,
+		Available: result.Item == nil,
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestAliasAvailability(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "taken1", LongURL: "https://example.com"})
+
+	tests := []struct {
+		alias     string
+		status    int
+		available bool
+	}{
+		{"free123", 200, true},
+		{"taken1", 200, false},
+		{"no spaces", 400, false},
+		{"health", 400, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			before := db.called("GetItem")
+			response := serve(t, newRequest("GET", "/api/available/"+tt.alias, ""))
+			if response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+			if tt.status == 400 {
+				if db.called("GetItem") != before {
+					t.Fatal("a malformed alias was looked up")
+				}
+				return
+			}
+			var got AvailabilityResponse
+			decode(t, response, &got)
+			if got.Available != tt.available {
+				t.Fatalf("available = %v, want %v", got.Available, tt.available)
+			}
+			if in := db.getInputs[len(db.getInputs)-1]; aws.ToString(in.ProjectionExpression) != "short_url" {
+				t.Fatalf("projection = %q, want only the key", aws.ToString(in.ProjectionExpression))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Lambda freezes the execution environment as soon as the handler returns,
+// so background writes still in flight can be lost. Each one is tracked,
+// and the handler waits a bounded time for them before returning.
+var (
+	flushBackgroundWrites  = os.Getenv("FLUSH_BACKGROUND_WRITES") != "false"
+	backgroundFlushTimeout = time.Duration(envInt("BACKGROUND_FLUSH_TIMEOUT_MS", 1000)) * time.Millisecond
+)
+
+// pendingWrites counts background writes that haven't finished yet. A
+// WaitGroup won't do: a flush that timed out is still waiting when the next
+// invocation adds to it. idle is closed whenever the count drops to zero.
+var pendingWrites struct {
+	sync.Mutex
+	count int
+	idle  chan struct{}
+}
+
+// goBackground runs fn in its own goroutine, tracked by pendingWrites
+func goBackground(fn func()) {
+	pendingWrites.Lock()
+	if pendingWrites.count == 0 {
+		pendingWrites.idle = make(chan struct{})
+	}
+	pendingWrites.count++
+	pendingWrites.Unlock()
+
+	go func() {
+		defer func() {
+			pendingWrites.Lock()
+			pendingWrites.count--
+			if pendingWrites.count == 0 {
+				close(pendingWrites.idle)
+			}
+			pendingWrites.Unlock()
+		}()
+		fn()
+	}()
+}
+
+// flushBackground waits for pending background writes, up to timeout.
+// Writes that are still running carry on and may complete in a later invocation.
+func flushBackground(l *slog.Logger, timeout time.Duration) {
+	if !flushBackgroundWrites {
+		return
+	}
+
+	pendingWrites.Lock()
+	if pendingWrites.count == 0 {
+		pendingWrites.Unlock()
+		return
+	}
+	idle := pendingWrites.idle
+	pendingWrites.Unlock()
+
+	select {
+	case <-idle:
+	case <-time.After(timeout):
+		l.Warn("Background writes still pending", slog.Duration("waited", timeout))
+	}
+}
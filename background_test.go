@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func TestBackgroundWritesFlushBeforeReturn(t *testing.T) {
+	setVar(t, &clicksTable, "clicks")
+	slowClicks := func(db *fakeDB, release <-chan struct{}) {
+		db.before = func(ctx context.Context, op string, input any) error {
+			if put, ok := input.(*dynamodb.PutItemInput); ok && *put.TableName == "clicks" {
+				<-release
+			}
+			return nil
+		}
+	}
+	// drain lets a held write finish so it can't leak into later tests
+	drain := func(release chan struct{}) {
+		close(release)
+		setVar(t, &flushBackgroundWrites, true)
+		flushBackground(baseLogger, time.Second)
+	}
+
+	t.Run("flushed", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+		release := make(chan struct{})
+		slowClicks(db, release)
+		time.AfterFunc(30*time.Millisecond, func() { close(release) })
+
+		serve(t, newRequest("GET", "/abc1234", ""))
+		if len(db.items("clicks")) != 1 || db.mapping(t, "abc1234").AccessCount != 1 {
+			t.Fatalf("clicks = %d, access_count = %d once the handler returned", len(db.items("clicks")), db.mapping(t, "abc1234").AccessCount)
+		}
+	})
+
+	t.Run("bounded wait", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+		setVar(t, &backgroundFlushTimeout, 20*time.Millisecond)
+		release := make(chan struct{})
+		slowClicks(db, release)
+		defer drain(release)
+
+		start := time.Now()
+		if response := serve(t, newRequest("GET", "/abc1234", "")); response.StatusCode != 302 {
+			t.Fatalf("redirect = %d", response.StatusCode)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("handler waited %v on a stuck write", elapsed)
+		}
+		if len(db.items("clicks")) != 0 {
+			t.Fatal("the held click was written")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+		setVar(t, &flushBackgroundWrites, false)
+		setVar(t, &backgroundFlushTimeout, time.Minute)
+		release := make(chan struct{})
+		slowClicks(db, release)
+		defer drain(release)
+
+		start := time.Now()
+		serve(t, newRequest("GET", "/abc1234", ""))
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("handler waited %v with flushing disabled", elapsed)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxBatchSize caps how many URLs one batch create takes
+const maxBatchSize = 25
+
+// BatchCreateRequest represents the expected JSON structure for batch creates
+type BatchCreateRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// BatchCreateResult reports the outcome for one URL in a batch
+type BatchCreateResult struct {
+	LongURL  string `json:"long_url"`
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BatchCreateResponse is the body returned from a batch create
+type BatchCreateResponse struct {
+	Results []BatchCreateResult `json:"results"`
+}
+
+// createBatch handles POST /api/urls/batch requests
+// Each URL is validated and written independently so one bad entry doesn't
+// fail the rest. Every write is a conditional PutItem, as for a single
+// create, so a colliding code is regenerated instead of overwriting a link.
+// Batches always use random codes whatever CODE_STRATEGY says.
+func createBatch(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err := requireJSONBody(request); err != nil {
+		return errorResponse(415, err.Error()), nil
+	}
+
+	var batchReq BatchCreateRequest
+	if err := json.Unmarshal([]byte(request.Body), &batchReq); err != nil {
+		return errorResponse(400, "Invalid request body"), nil
+	}
+	if len(batchReq.URLs) == 0 {
+		return errorResponse(400, "urls is required"), nil
+	}
+	if len(batchReq.URLs) > maxBatchSize {
+		return errorResponse(400, fmt.Sprintf("at most %d urls per batch", maxBatchSize)), nil
+	}
+
+	tenant := requestTenant(request)
+	if tenant != "" {
+		if err := validateCustomAlias(tenant); err != nil {
+			return errorResponse(400, "invalid tenant"), nil
+		}
+	}
+
+	results := make([]BatchCreateResult, len(batchReq.URLs))
+	longURLs := map[int]string{} // Index in results -> normalized URL, for entries that passed validation
+	now := time.Now()
+	createdBy := requestPrincipal(request)
+	for i, raw := range batchReq.URLs {
+		results[i].LongURL = raw
+
+		longURL, err := cleanLongURL(raw)
+		if err != nil {
+			results[i].Error = longURLErrorMessage(err)
+			continue
+		}
+		longURLs[i] = longURL
+	}
+
+	// The whole batch has to fit in the tenant's quota
+	if tenantQuotaEnabled(tenant) && len(longURLs) > 0 {
+		used, err := takeQuota(ctx, tenantQuotaID(tenant), maxLinksPerTenant, len(longURLs))
+		if errors.Is(err, errQuotaExceeded) {
+			return jsonResponse(403, QuotaErrorResponse{Error: "tenant link limit reached", Used: used, Limit: maxLinksPerTenant})
+		}
+		if err != nil {
+			return errorResponse(500, "Error updating quota"), err
+		}
+	}
+
+	unwritten := 0
+	for i, longURL := range longURLs {
+		shortURL, err := putBatchMapping(ctx, URLMapping{
+			LongURL:   longURL,
+			CreatedAt: now,
+			Tenant:    tenant,
+			CreatedBy: createdBy,
+			RankKey:   newRankKey(),
+		})
+		if err != nil {
+			loggerFrom(ctx).Error("Error writing batch item", slog.Any("error", err))
+			results[i].Error = "Error saving to DynamoDB"
+			unwritten++
+			continue
+		}
+		results[i].ShortURL = shortURL
+	}
+
+	// Hand back the quota taken for links that were never stored
+	if tenantQuotaEnabled(tenant) && unwritten > 0 {
+		releaseQuota(ctx, tenantQuotaID(tenant), unwritten)
+	}
+
+	return jsonResponse(200, BatchCreateResponse{Results: results})
+}
+
+// putBatchMapping stores urlMapping under a fresh random code, trying another
+// code when one is taken, and returns the code it was stored under
+func putBatchMapping(ctx context.Context, urlMapping URLMapping) (string, error) {
+	for attempt := 1; ; attempt++ {
+		urlMapping.setKey(mappingKey(urlMapping.Tenant, generateShortCode(shortCodeLength)))
+		item, err := attributevalue.MarshalMap(urlMapping)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = ddbClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           &tableName,
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(short_url)"),
+		})
+		if err == nil {
+			return urlMapping.ShortURL, nil
+		}
+
+		var condErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &condErr) || attempt >= maxCreateAttempts {
+			return "", err
+		}
+		loggerFrom(ctx).Warn("Short code already taken, retrying", slog.String("short_code", urlMapping.ShortURL))
+	}
+}
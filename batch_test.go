@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestBatchCreate(t *testing.T) {
+	t.Run("full batch", func(t *testing.T) {
+		db := useFakeDB(t)
+		urls := make([]string, maxBatchSize)
+		for i := range urls {
+			urls[i] = fmt.Sprintf("https://example.com/%d", i)
+		}
+		body, _ := json.Marshal(BatchCreateRequest{URLs: urls})
+
+		response := serve(t, newRequest("POST", "/api/urls/batch", string(body)))
+		var got BatchCreateResponse
+		decode(t, response, &got)
+		if response.StatusCode != 200 || len(got.Results) != maxBatchSize {
+			t.Fatalf("batch = %d with %d results", response.StatusCode, len(got.Results))
+		}
+		for i, result := range got.Results {
+			if result.LongURL != urls[i] || result.ShortURL == "" || result.Error != "" {
+				t.Fatalf("result %d = %+v", i, result)
+			}
+		}
+		if n := len(db.items("urls")); n != maxBatchSize {
+			t.Fatalf("%d links stored, want %d", n, maxBatchSize)
+		}
+	})
+
+	t.Run("one invalid url", func(t *testing.T) {
+		db := useFakeDB(t)
+		response := serve(t, newRequest("POST", "/api/urls/batch", `{"urls":["https://example.com/a","ftp://example.com","https://example.com/b"]}`))
+		var got BatchCreateResponse
+		decode(t, response, &got)
+		if response.StatusCode != 200 || len(got.Results) != 3 {
+			t.Fatalf("batch = %d with %d results", response.StatusCode, len(got.Results))
+		}
+		if got.Results[1].Error == "" || got.Results[1].ShortURL != "" {
+			t.Fatalf("invalid entry = %+v", got.Results[1])
+		}
+		if got.Results[0].ShortURL == "" || got.Results[2].ShortURL == "" {
+			t.Fatalf("valid entries = %+v, %+v", got.Results[0], got.Results[2])
+		}
+		if n := len(db.items("urls")); n != 2 {
+			t.Fatalf("%d links stored, want 2", n)
+		}
+	})
+
+	t.Run("over the limit", func(t *testing.T) {
+		db := useFakeDB(t)
+		urls := make([]string, maxBatchSize+1)
+		for i := range urls {
+			urls[i] = "https://example.com"
+		}
+		body, _ := json.Marshal(BatchCreateRequest{URLs: urls})
+		if response := serve(t, newRequest("POST", "/api/urls/batch", string(body))); response.StatusCode != 400 {
+			t.Fatalf("status = %d, want 400", response.StatusCode)
+		}
+		if db.called("PutItem") != 0 {
+			t.Fatal("an oversized batch wrote to DynamoDB")
+		}
+	})
+
+	t.Run("taken code is regenerated", func(t *testing.T) {
+		db := useFakeDB(t)
+		rejected := false
+		db.before = func(ctx context.Context, op string, input any) error {
+			if op == "PutItem" && !rejected {
+				rejected = true
+				return &types.ConditionalCheckFailedException{Message: aws.String("taken")}
+			}
+			return nil
+		}
+		response := serve(t, newRequest("POST", "/api/urls/batch", `{"urls":["https://example.com"]}`))
+		var got BatchCreateResponse
+		decode(t, response, &got)
+		if got.Results[0].ShortURL == "" || db.called("PutItem") != 2 {
+			t.Fatalf("result = %+v after %d PutItems", got.Results[0], db.called("PutItem"))
+		}
+		if db.called("BatchWriteItem") != 0 {
+			t.Fatal("batch create used an unconditional BatchWriteItem")
+		}
+	})
+}
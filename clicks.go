@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ClickEvent is a single redirect recorded in the clicks table.
+// The table uses short_url as the hash key and click_id as the range key.
+type ClickEvent struct {
+	ShortURL  string    `json:"short_url" dynamodbav:"short_url"`
+	ClickID   string    `json:"click_id" dynamodbav:"click_id"` // Sortable timestamp plus a random suffix
+	ClickedAt time.Time `json:"clicked_at" dynamodbav:"clicked_at"`
+	Referer   string    `json:"referer,omitempty" dynamodbav:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty" dynamodbav:"user_agent,omitempty"`
+	SourceIP  string    `json:"source_ip,omitempty" dynamodbav:"source_ip,omitempty"`
+	Variant   string    `json:"variant,omitempty" dynamodbav:"variant,omitempty"` // Destination served for an A/B split
+}
+
+// ClickStats is the aggregated view of a short URL's clicks.
+// Large histories come back in pages; sum the counts across them.
+type ClickStats struct {
+	ShortURL    string         `json:"short_url"`
+	TotalClicks int            `json:"total_clicks"`
+	ByReferer   map[string]int `json:"by_referer"`
+	From        *time.Time     `json:"from,omitempty"`
+	To          *time.Time     `json:"to,omitempty"`
+	NextCursor  string         `json:"next_cursor,omitempty"` // Pass back as ?cursor= for the next page
+}
+
+// clickStatsPageSize caps how many clicks one stats request reads
+const clickStatsPageSize = 10000
+
+// clickIDLayout is fixed width so click IDs sort in time order
+const clickIDLayout = "20060102T150405.000000000Z"
+
+// clickWriteTimeout bounds how long a background click write may take
+const clickWriteTimeout = 2 * time.Second
+
+// clicksTable is the DynamoDB table for click events; recording is skipped when unset
+var clicksTable = os.Getenv("CLICKS_TABLE")
+
+// newClickEvent captures the analytics fields from a redirect request
+func newClickEvent(shortURL string, request events.APIGatewayProxyRequest, now time.Time) ClickEvent {
+	return ClickEvent{
+		ShortURL:  shortURL,
+		ClickID:   fmt.Sprintf("%s#%s", now.UTC().Format(clickIDLayout), generateShortCode(6)),
+		ClickedAt: now,
+		Referer:   headerValue(request, "Referer"),
+		UserAgent: headerValue(request, "User-Agent"),
+		SourceIP:  request.RequestContext.Identity.SourceIP,
+	}
+}
+
+// recordClick writes a click event in the background so the redirect isn't delayed.
+// The write uses its own deadline because the request context ends with the response,
+// and handleRequest gives it a bounded time to finish before returning.
+func recordClick(ctx context.Context, event ClickEvent) {
+	if clicksTable == "" {
+		return
+	}
+
+	goBackground(func() {
+		writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), clickWriteTimeout)
+		defer cancel()
+
+		if err := putClickEvent(writeCtx, event); err != nil {
+			loggerFrom(ctx).Error("Error recording click", slog.String("short_code", event.ShortURL), slog.Any("error", err))
+		}
+	})
+}
+
+// putClickEvent saves a single click event to the clicks table
+func putClickEvent(ctx context.Context, event ClickEvent) error {
+	item, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		return err
+	}
+	_, err = ddbClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &clicksTable,
+		Item:      item,
+	})
+	return err
+}
+
+// getClickStats handles GET /api/{shortURL}/stats requests
+// It returns the total click count and a per-referer breakdown, optionally
+// limited to clicks between the RFC3339 ?from and ?to times. At most
+// clickStatsPageSize clicks are counted per request; next_cursor continues.
+func getClickStats(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	shortURL := requestShortURL(request)
+	if clicksTable == "" {
+		return errorResponse(501, "Click analytics are not enabled"), nil
+	}
+
+	stats := ClickStats{
+		ShortURL:  shortURL,
+		ByReferer: map[string]int{},
+	}
+
+	from, to, err := clickTimeRange(request, time.Time{}, time.Now().UTC())
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+	input := &dynamodb.QueryInput{
+		TableName:              &clicksTable,
+		KeyConditionExpression: aws.String("short_url = :s"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":s": &types.AttributeValueMemberS{Value: shortURL},
+		},
+	}
+	if request.QueryStringParameters["from"] != "" || request.QueryStringParameters["to"] != "" {
+		input = clickRangeQuery(shortURL, from, to)
+		stats.From, stats.To = &from, &to
+	}
+	if cursor := request.QueryStringParameters["cursor"]; cursor != "" {
+		startKey, err := decodeCursor(cursor)
+		if err != nil {
+			return errorResponse(400, "invalid cursor"), nil
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	// Page through clicks for this code until the per-request budget runs out
+	read := 0
+	for {
+		input.Limit = aws.Int32(int32(clickStatsPageSize - read))
+		page, err := ddbClient.Query(ctx, input)
+		if err != nil {
+			return errorResponse(500, "Error querying DynamoDB"), err
+		}
+		read += len(page.Items)
+
+		var clicks []ClickEvent
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &clicks); err != nil {
+			return errorResponse(500, "Error unmarshaling item"), err
+		}
+		for _, click := range clicks {
+			stats.TotalClicks++
+			referer := click.Referer
+			if referer == "" {
+				referer = "direct"
+			}
+			stats.ByReferer[referer]++
+		}
+
+		if len(page.LastEvaluatedKey) == 0 {
+			break
+		}
+		if read >= clickStatsPageSize {
+			stats.NextCursor, err = encodeCursor(page.LastEvaluatedKey)
+			if err != nil {
+				return errorResponse(500, "Error encoding cursor"), err
+			}
+			break
+		}
+		input.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+
+	return jsonResponse(200, stats)
+}
+
+// ClickBucket is the number of clicks in one time bucket
+type ClickBucket struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int       `json:"count"`
+}
+
+// ClickSeriesResponse is the body of GET /api/{shortURL}/clicks.
+// Long ranges come back in pages; a bucket split across two pages appears
+// in both, so add the counts for matching buckets.
+type ClickSeriesResponse struct {
+	ShortURL    string        `json:"short_url"`
+	Granularity string        `json:"granularity"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Series      []ClickBucket `json:"series"`
+	NextCursor  string        `json:"next_cursor,omitempty"` // Pass back as ?cursor= for the next page
+}
+
+// defaultClickSeriesRange is how far back the series goes when ?from is absent
+const defaultClickSeriesRange = 7 * 24 * time.Hour
+
+// getClickSeries handles GET /api/{shortURL}/clicks requests
+// It buckets clicks by ?granularity (hour or day, default day) between the
+// RFC3339 ?from and ?to times, which default to the last seven days. Like
+// getClickStats it reads at most clickStatsPageSize clicks per request.
+func getClickSeries(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	shortURL := requestShortURL(request)
+	if clicksTable == "" {
+		return errorResponse(501, "Click analytics are not enabled"), nil
+	}
+
+	granularity := request.QueryStringParameters["granularity"]
+	var bucketSize time.Duration
+	switch granularity {
+	case "", "day":
+		granularity, bucketSize = "day", 24*time.Hour
+	case "hour":
+		bucketSize = time.Hour
+	default:
+		return errorResponse(400, "granularity must be hour or day"), nil
+	}
+
+	now := time.Now().UTC()
+	from, to, err := clickTimeRange(request, now.Add(-defaultClickSeriesRange), now)
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+
+	input := clickRangeQuery(shortURL, from, to)
+	if cursor := request.QueryStringParameters["cursor"]; cursor != "" {
+		startKey, err := decodeCursor(cursor)
+		if err != nil {
+			return errorResponse(400, "invalid cursor"), nil
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	// Page through the range until the per-request budget runs out
+	counts := map[time.Time]int{}
+	var nextCursor string
+	read := 0
+	for {
+		input.Limit = aws.Int32(int32(clickStatsPageSize - read))
+		page, err := ddbClient.Query(ctx, input)
+		if err != nil {
+			return errorResponse(500, "Error querying DynamoDB"), err
+		}
+		read += len(page.Items)
+
+		var clicks []ClickEvent
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &clicks); err != nil {
+			return errorResponse(500, "Error unmarshaling item"), err
+		}
+		for _, click := range clicks {
+			counts[click.ClickedAt.UTC().Truncate(bucketSize)]++
+		}
+
+		if len(page.LastEvaluatedKey) == 0 {
+			break
+		}
+		if read >= clickStatsPageSize {
+			nextCursor, err = encodeCursor(page.LastEvaluatedKey)
+			if err != nil {
+				return errorResponse(500, "Error encoding cursor"), err
+			}
+			break
+		}
+		input.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+
+	// No clicks is an empty series for a real code, but 404 for an unknown one
+	if len(counts) == 0 {
+		urlMapping, err := getMapping(ctx, shortURL)
+		if err != nil {
+			return errorResponse(500, "Error querying DynamoDB"), err
+		}
+		if urlMapping == nil {
+			return errorResponse(404, "URL not found"), nil
+		}
+	}
+
+	series := make([]ClickBucket, 0, len(counts))
+	for bucket, count := range counts {
+		series = append(series, ClickBucket{Bucket: bucket, Count: count})
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Bucket.Before(series[j].Bucket) })
+
+	return jsonResponse(200, ClickSeriesResponse{
+		ShortURL:    shortURL,
+		Granularity: granularity,
+		From:        from,
+		To:          to,
+		Series:      series,
+		NextCursor:  nextCursor,
+	})
+}
+
+// clickRangeQuery builds a query for shortURL's clicks between from and to.
+// Click IDs start with a fixed-width timestamp, so a BETWEEN on the range key
+// selects the time window; "~" sorts after the "#suffix" so to is inclusive.
+func clickRangeQuery(shortURL string, from, to time.Time) *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		TableName:              &clicksTable,
+		KeyConditionExpression: aws.String("short_url = :s AND click_id BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":s":    &types.AttributeValueMemberS{Value: shortURL},
+			":from": &types.AttributeValueMemberS{Value: from.UTC().Format(clickIDLayout)},
+			":to":   &types.AttributeValueMemberS{Value: to.UTC().Format(clickIDLayout) + "~"},
+		},
+	}
+}
+
+// clickTimeRange reads the RFC3339 ?from and ?to parameters, using the
+// defaults for whichever is absent, and checks that from is before to
+func clickTimeRange(request events.APIGatewayProxyRequest, defaultFrom, defaultTo time.Time) (time.Time, time.Time, error) {
+	from, to := defaultFrom, defaultTo
+	var err error
+	if raw := request.QueryStringParameters["from"]; raw != "" {
+		if from, err = time.Parse(time.RFC3339, raw); err != nil {
+			return from, to, errors.New("from must be an RFC3339 time")
+		}
+	}
+	if raw := request.QueryStringParameters["to"]; raw != "" {
+		if to, err = time.Parse(time.RFC3339, raw); err != nil {
+			return from, to, errors.New("to must be an RFC3339 time")
+		}
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+func TestRedirectRecordsClickEvent(t *testing.T) {
+	for _, referer := range []string{"https://news.example.org/", ""} {
+		t.Run("referer "+referer, func(t *testing.T) {
+			db := useFakeDB(t)
+			setVar(t, &clicksTable, "clicks")
+			seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+
+			request := newRequest("GET", "/abc1234", "")
+			request.Headers["User-Agent"] = "test-agent"
+			if referer != "" {
+				request.Headers["Referer"] = referer
+			}
+			if response := serve(t, request); response.StatusCode != 302 {
+				t.Fatalf("status = %d, want 302", response.StatusCode)
+			}
+
+			clicks := db.items("clicks")
+			if len(clicks) != 1 {
+				t.Fatalf("%d click events written, want 1", len(clicks))
+			}
+			var click ClickEvent
+			if err := attributevalue.UnmarshalMap(clicks[0], &click); err != nil {
+				t.Fatal(err)
+			}
+			if click.ShortURL != "abc1234" || click.ClickID == "" || click.ClickedAt.IsZero() ||
+				click.Referer != referer || click.UserAgent != "test-agent" || click.SourceIP != "203.0.113.7" {
+				t.Fatalf("click event = %+v", click)
+			}
+		})
+	}
+}
+
+func TestClickStatsAggregatesByReferer(t *testing.T) {
+	db := useFakeDB(t)
+	setVar(t, &clicksTable, "clicks")
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+	for _, referer := range []string{"https://a.example", "https://a.example", ""} {
+		request := newRequest("GET", "/abc1234", "")
+		if referer != "" {
+			request.Headers["Referer"] = referer
+		}
+		serve(t, request)
+	}
+
+	for _, path := range []string{"/api/abc1234/stats", "/api/abc1234/clicks"} {
+		if response := serve(t, newRequest("GET", path, "")); response.StatusCode != 401 {
+			t.Fatalf("%s without a key = %d, want 401", path, response.StatusCode)
+		}
+	}
+	response := serve(t, withAPIKey(newRequest("GET", "/api/abc1234/stats", "")))
+	var stats ClickStats
+	decode(t, response, &stats)
+	if response.StatusCode != 200 || stats.TotalClicks != 3 || stats.ByReferer["https://a.example"] != 2 {
+		t.Fatalf("stats = %d %+v", response.StatusCode, stats)
+	}
+}
+
+func TestClickSeriesBucketsByDay(t *testing.T) {
+	db := useFakeDB(t)
+	setVar(t, &clicksTable, "clicks")
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+	seedLink(t, db, URLMapping{ShortURL: "quiet12", LongURL: "https://example.com"})
+	for _, at := range []string{"2024-05-01T08:00:00Z", "2024-05-01T23:59:59Z", "2024-05-02T00:00:00Z", "2024-04-30T12:00:00Z"} {
+		clickedAt, _ := time.Parse(time.RFC3339, at)
+		db.seed(t, "clicks", newClickEvent("abc1234", newRequest("GET", "/abc1234", ""), clickedAt))
+	}
+	rangeQuery := "from=2024-05-01T00:00:00Z&to=2024-05-02T23:59:59Z"
+
+	var got ClickSeriesResponse
+	decode(t, serve(t, withAPIKey(newRequest("GET", "/api/abc1234/clicks?"+rangeQuery, ""))), &got)
+	var buckets []string
+	for _, b := range got.Series {
+		buckets = append(buckets, fmt.Sprintf("%s=%d", b.Bucket.Format("2006-01-02"), b.Count))
+	}
+	if want := "2024-05-01=2,2024-05-02=1"; got.Granularity != "day" || strings.Join(buckets, ",") != want {
+		t.Fatalf("series = %s %v, want day %s", got.Granularity, buckets, want)
+	}
+
+	var hourly ClickSeriesResponse
+	decode(t, serve(t, withAPIKey(newRequest("GET", "/api/abc1234/clicks?granularity=hour&"+rangeQuery, ""))), &hourly)
+	if len(hourly.Series) != 3 {
+		t.Fatalf("hourly series has %d buckets, want 3", len(hourly.Series))
+	}
+
+	response := serve(t, withAPIKey(newRequest("GET", "/api/quiet12/clicks?"+rangeQuery, "")))
+	if response.StatusCode != 200 || !strings.Contains(response.Body, `"series":[]`) {
+		t.Fatalf("no clicks = %d %s, want an empty series", response.StatusCode, response.Body)
+	}
+	if response := serve(t, withAPIKey(newRequest("GET", "/api/missing1/clicks", ""))); response.StatusCode != 404 {
+		t.Fatalf("unknown code = %d, want 404", response.StatusCode)
+	}
+}
+
+func TestClickStatsRangeAndCursor(t *testing.T) {
+	db := useFakeDB(t)
+	setVar(t, &clicksTable, "clicks")
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	click := func(at time.Time, n int) ClickEvent {
+		return ClickEvent{ShortURL: "abc1234", ClickID: fmt.Sprintf("%s#%06d", at.Format(clickIDLayout), n), ClickedAt: at}
+	}
+
+	t.Run("bounded range", func(t *testing.T) {
+		for i, offset := range []int{-2, 0, 1, 3} {
+			db.seed(t, "clicks", click(day.AddDate(0, 0, offset), i))
+		}
+		response := serve(t, withAPIKey(newRequest("GET", "/api/abc1234/stats?from=2026-02-28T12:00:00Z&to=2026-03-02T12:00:00Z", "")))
+		var stats ClickStats
+		decode(t, response, &stats)
+		if response.StatusCode != 200 || stats.TotalClicks != 2 || stats.From == nil || stats.NextCursor != "" {
+			t.Fatalf("stats = %d %+v", response.StatusCode, stats)
+		}
+	})
+
+	t.Run("invalid ranges", func(t *testing.T) {
+		for _, query := range []string{
+			"from=2026-03-02T00:00:00Z&to=2026-03-01T00:00:00Z",
+			"from=yesterday",
+			"cursor=not-a-cursor",
+		} {
+			if response := serve(t, withAPIKey(newRequest("GET", "/api/abc1234/stats?"+query, ""))); response.StatusCode != 400 {
+				t.Errorf("%s = %d, want 400", query, response.StatusCode)
+			}
+		}
+	})
+
+	t.Run("cursor continuation", func(t *testing.T) {
+		db := useFakeDB(t)
+		total := clickStatsPageSize + 5
+		for i := 0; i < total; i++ {
+			db.seed(t, "clicks", click(day.Add(time.Duration(i)*time.Second), i))
+		}
+
+		var first, second ClickStats
+		decode(t, serve(t, withAPIKey(newRequest("GET", "/api/abc1234/stats", ""))), &first)
+		if first.TotalClicks != clickStatsPageSize || first.NextCursor == "" {
+			t.Fatalf("first page = %d clicks, cursor %q", first.TotalClicks, first.NextCursor)
+		}
+		decode(t, serve(t, withAPIKey(newRequest("GET", "/api/abc1234/stats?cursor="+first.NextCursor, ""))), &second)
+		if second.TotalClicks != 5 || second.NextCursor != "" {
+			t.Fatalf("second page = %d clicks, cursor %q", second.TotalClicks, second.NextCursor)
+		}
+
+		// The series reads the same budget per request and continues the same way
+		rangeQuery := "from=2026-02-28T00:00:00Z&to=2026-03-02T00:00:00Z"
+		sum := func(series ClickSeriesResponse) (n int) {
+			for _, bucket := range series.Series {
+				n += bucket.Count
+			}
+			return n
+		}
+		var firstSeries, secondSeries ClickSeriesResponse
+		decode(t, serve(t, withAPIKey(newRequest("GET", "/api/abc1234/clicks?"+rangeQuery, ""))), &firstSeries)
+		if sum(firstSeries) != clickStatsPageSize || firstSeries.NextCursor == "" {
+			t.Fatalf("first series page = %d clicks, cursor %q", sum(firstSeries), firstSeries.NextCursor)
+		}
+		decode(t, serve(t, withAPIKey(newRequest("GET", "/api/abc1234/clicks?cursor="+firstSeries.NextCursor+"&"+rangeQuery, ""))), &secondSeries)
+		if sum(secondSeries) != 5 || secondSeries.NextCursor != "" {
+			t.Fatalf("second series page = %d clicks, cursor %q", sum(secondSeries), secondSeries.NextCursor)
+		}
+	})
+}
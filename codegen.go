@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CodeGenerator produces the short code for a new link
+type CodeGenerator interface {
+	Generate(ctx context.Context, longURL string) (string, error)
+}
+
+// randomGenerator draws codes uniformly from shortCodeAlphabet
+type randomGenerator struct{}
+
+func (randomGenerator) Generate(ctx context.Context, longURL string) (string, error) {
+	return generateShortCode(shortCodeLength), nil
+}
+
+// counterGenerator numbers links in creation order using an atomic counter
+// in counterTable, which has a string hash key named counter_id. Codes are
+// predictable, so only use it where guessable links are fine.
+type counterGenerator struct{}
+
+func (counterGenerator) Generate(ctx context.Context, longURL string) (string, error) {
+	result, err := ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &counterTable,
+		Key: map[string]types.AttributeValue{
+			"counter_id": &types.AttributeValueMemberS{Value: "short_codes"},
+		},
+		UpdateExpression:         aws.String("ADD #v :one"),
+		ExpressionAttributeNames: map[string]string{"#v": "value"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := result.Attributes["value"].(*types.AttributeValueMemberN)
+	if !ok {
+		return "", errors.New("counter update returned no value")
+	}
+	n, ok := new(big.Int).SetString(value.Value, 10)
+	if !ok {
+		return "", errors.New("counter value is not an integer")
+	}
+	return encodeInAlphabet(n, shortCodeLength), nil
+}
+
+// hashGenerator derives the code from a SHA-256 of the normalized long URL,
+// so the same destination always gets the same code. createShortURL returns
+// the existing link when the URL was shortened before, and lengthens the code
+// when a different URL's hash shares the prefix. Other create options, like
+// expiry or UTM tags, don't change the code.
+type hashGenerator struct{}
+
+func (hashGenerator) Generate(ctx context.Context, longURL string) (string, error) {
+	return hashCode(longURL, shortCodeLength), nil
+}
+
+// hashCode is n characters of longURL's SHA-256 in shortCodeAlphabet.
+// The digits are taken least significant first: the leading digit of the
+// full 256-bit value is nearly always 0 or 1, but the low-order ones are
+// evenly spread. A longer code still starts with the shorter one.
+func hashCode(longURL string, n int) string {
+	sum := sha256.Sum256([]byte(longURL))
+	alphabet := shortCodeAlphabet()
+	base := big.NewInt(int64(len(alphabet)))
+	value := new(big.Int).SetBytes(sum[:])
+	digit := new(big.Int)
+
+	out := make([]byte, n)
+	for i := range out {
+		value.DivMod(value, base, digit)
+		out[i] = alphabet[digit.Int64()]
+	}
+	return string(out)
+}
+
+// encodeInAlphabet writes n in base len(shortCodeAlphabet), most significant
+// digit first, left-padded with the alphabet's first character to width
+func encodeInAlphabet(n *big.Int, width int) string {
+	alphabet := shortCodeAlphabet()
+	base := big.NewInt(int64(len(alphabet)))
+	n = new(big.Int).Set(n)
+	digit := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, digit)
+		out = append(out, alphabet[digit.Int64()])
+	}
+	for len(out) < width {
+		out = append(out, alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// counterTable holds the atomic counter for the counter strategy
+var counterTable = os.Getenv("COUNTER_TABLE")
+
+// codeGenerator is the strategy new links get their codes from, picked by
+// CODE_STRATEGY: random (the default), counter or hash
+var codeGenerator = newCodeGenerator(os.Getenv("CODE_STRATEGY"))
+
+// newCodeGenerator returns the generator for strategy, falling back to
+// random with a warning when it is unknown or can't be used
+func newCodeGenerator(strategy string) CodeGenerator {
+	switch strings.ToLower(strategy) {
+	case "", "random":
+		return randomGenerator{}
+	case "counter":
+		if counterTable == "" {
+			baseLogger.Warn("CODE_STRATEGY=counter needs COUNTER_TABLE; using random codes")
+			return randomGenerator{}
+		}
+		return counterGenerator{}
+	case "hash":
+		return hashGenerator{}
+	default:
+		baseLogger.Warn("Ignoring unknown CODE_STRATEGY", slog.String("value", strategy))
+		return randomGenerator{}
+	}
+}
+
+// previewCode is the code a dry run shows. It never advances the counter,
+// so with that strategy the code is only an example.
+func previewCode(ctx context.Context, longURL string) string {
+	if _, ok := codeGenerator.(counterGenerator); ok {
+		return generateShortCode(shortCodeLength)
+	}
+	code, err := codeGenerator.Generate(ctx, longURL)
+	if err != nil {
+		return generateShortCode(shortCodeLength)
+	}
+	return code
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestCodeGeneratorStrategies(t *testing.T) {
+	useFakeDB(t)
+	setVar(t, &counterTable, "counters")
+
+	for _, strategy := range []string{"random", "counter", "hash"} {
+		t.Run(strategy, func(t *testing.T) {
+			generator := newCodeGenerator(strategy)
+			code, err := generator.Generate(context.Background(), "https://example.com/"+strategy)
+			if err != nil || len(code) != shortCodeLength || !inShortCodeAlphabet(code) || validateCustomAlias(code) != nil {
+				t.Fatalf("%s code = %q, %v", strategy, code, err)
+			}
+		})
+	}
+
+	t.Run("counter increments", func(t *testing.T) {
+		generator := newCodeGenerator("counter")
+		previous := ""
+		for i := 0; i < 40; i++ {
+			code, err := generator.Generate(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Fixed-width codes in alphabet order compare like the numbers they encode
+			if code <= previous {
+				t.Fatalf("code %q after %q", code, previous)
+			}
+			previous = code
+		}
+	})
+
+	t.Run("fallbacks", func(t *testing.T) {
+		if _, ok := newCodeGenerator("uuid").(randomGenerator); !ok {
+			t.Error("an unknown strategy should fall back to random")
+		}
+		setVar(t, &counterTable, "")
+		if _, ok := newCodeGenerator("counter").(randomGenerator); !ok {
+			t.Error("counter without COUNTER_TABLE should fall back to random")
+		}
+	})
+}
+
+func TestHashCodes(t *testing.T) {
+	db := useFakeDB(t)
+	setVar[CodeGenerator](t, &codeGenerator, hashGenerator{})
+
+	first := createLink(t, `{"long_url":"https://example.com/same"}`)
+	if first.ShortURL != hashCode("https://example.com/same", shortCodeLength) {
+		t.Fatalf("code = %q, want the URL's hash", first.ShortURL)
+	}
+	response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com/same"}`))
+	var again URLMapping
+	decode(t, response, &again)
+	if response.StatusCode != 200 || again.ShortURL != first.ShortURL || len(db.items("urls")) != 1 {
+		t.Fatalf("second create = %d %q, %d items", response.StatusCode, again.ShortURL, len(db.items("urls")))
+	}
+
+	t.Run("no collisions at the default length", func(t *testing.T) {
+		seen := map[string]string{}
+		for i := 0; i < 2000; i++ {
+			longURL := fmt.Sprintf("https://example.com/page/%d", i)
+			code := hashCode(longURL, shortCodeLength)
+			if other, ok := seen[code]; ok {
+				t.Fatalf("%s and %s both hash to %s", other, longURL, code)
+			}
+			seen[code] = longURL
+		}
+	})
+
+	t.Run("a taken prefix lengthens the code", func(t *testing.T) {
+		longURL := "https://example.com/unlucky"
+		short := hashCode(longURL, shortCodeLength)
+		long := hashCode(longURL, shortCodeLength+1)
+		if !strings.HasPrefix(long, short) {
+			t.Fatalf("%q doesn't extend %q", long, short)
+		}
+		seedLink(t, db, URLMapping{ShortURL: short, LongURL: "https://example.com/other"})
+
+		created := createLink(t, `{"long_url":"`+longURL+`"}`)
+		if created.ShortURL != long {
+			t.Fatalf("code = %q, want %q", created.ShortURL, long)
+		}
+	})
+
+	// A link for the same URL is only handed back when the create would
+	// have made exactly that link
+	for _, tt := range []struct {
+		name, body string
+		stored     URLMapping
+	}{
+		{"different password", `{"long_url":"https://example.com/opts","password":"hunter2"}`, URLMapping{}},
+		{"different max_clicks", `{"long_url":"https://example.com/opts","max_clicks":5}`, URLMapping{}},
+		{"different webhook", `{"long_url":"https://example.com/opts","webhook_url":"https://hooks.example/a"}`, URLMapping{}},
+		{"different destinations", `{"long_url":"https://example.com/opts","destinations":[{"url":"https://a.example","weight":1},{"url":"https://b.example","weight":1}]}`, URLMapping{}},
+		{"different geo", `{"long_url":"https://example.com/opts","geo_destinations":{"DE":"https://example.de"}}`, URLMapping{}},
+		{"different redirect headers", `{"long_url":"https://example.com/opts","redirect_headers":{"Referrer-Policy":"no-referrer"}}`, URLMapping{}},
+		{"with an expiry", `{"long_url":"https://example.com/opts","expires_in_seconds":60}`, URLMapping{}},
+		{"another creator", `{"long_url":"https://example.com/opts"}`, URLMapping{CreatedBy: "someone-else"}},
+		{"paused", `{"long_url":"https://example.com/opts"}`, URLMapping{Enabled: aws.Bool(false)}},
+		{"out of clicks", `{"long_url":"https://example.com/opts"}`, URLMapping{MaxClicks: 2, AccessCount: 2}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t)
+			longURL := "https://example.com/opts"
+			stored := tt.stored
+			stored.ShortURL, stored.LongURL = hashCode(longURL, shortCodeLength), longURL
+			if stored.CreatedBy == "" {
+				stored.CreatedBy = anonymousPrincipal
+			}
+			seedLink(t, db, stored)
+
+			created := createLink(t, tt.body)
+			if created.ShortURL != hashCode(longURL, shortCodeLength+1) {
+				t.Fatalf("code = %q, want the next hash length", created.ShortURL)
+			}
+			if created.CreatedBy == "someone-else" {
+				t.Fatal("create returned another caller's link")
+			}
+		})
+	}
+	t.Run("same password reuses", func(t *testing.T) {
+		db := useFakeDB(t)
+		first := createLink(t, `{"long_url":"https://example.com/secret","password":"hunter2"}`)
+		response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com/secret","password":"hunter2"}`))
+		var again URLMapping
+		decode(t, response, &again)
+		if response.StatusCode != 200 || again.ShortURL != first.ShortURL || len(db.items("urls")) != 1 {
+			t.Fatalf("second create = %d %q, %d items", response.StatusCode, again.ShortURL, len(db.items("urls")))
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Destinations are checked with isPrivateHost when they are created, but a
+// public name can still resolve to an internal address, or redirect to one.
+// Clients that fetch destinations connect through publicOnlyTransport, which
+// checks the address actually dialed, after DNS and after every redirect.
+
+// publicOnlyTransport returns a transport that refuses to connect to private
+// addresses unless ALLOW_PRIVATE_HOSTS is set. It never uses a proxy, since
+// the proxy's address is all the check would see.
+func publicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: rejectPrivateAddress,
+	}
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// rejectPrivateAddress is a net.Dialer Control function; address is the
+// resolved ip:port about to be connected to
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	if allowPrivateHosts {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return fmt.Errorf("refusing to connect to %s: %w", host, errPrivateHost)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// exportMaxBytes is how much CSV one export response carries. Lambda caps
+// responses at 6MB, and one more scan page plus JSON escaping must still fit.
+const exportMaxBytes = 3 << 20
+
+// exportCSV handles GET /api/export requests
+// It scans the table into CSV until exportMaxBytes is reached. When more
+// remains, the X-Next-Cursor header holds a ?cursor= for the next part; only
+// the first part has the header row, so the parts concatenate into one file.
+func exportCSV(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	input := &dynamodb.ScanInput{
+		TableName: &tableName,
+	}
+	cursor := request.QueryStringParameters["cursor"]
+	if cursor != "" {
+		startKey, err := decodeCursor(cursor)
+		if err != nil {
+			return errorResponse(400, "invalid cursor"), nil
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if cursor == "" {
+		w.Write([]string{"short_url", "long_url", "created_at", "access_count"})
+	}
+
+	nextCursor := ""
+	for {
+		page, err := ddbClient.Scan(ctx, input)
+		if err != nil {
+			return errorResponse(500, "Error scanning DynamoDB"), err
+		}
+
+		var mappings []URLMapping
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &mappings); err != nil {
+			return errorResponse(500, "Error unmarshaling item"), err
+		}
+		for _, m := range mappings {
+			// csv.Writer quotes fields containing commas, quotes or newlines
+			w.Write([]string{
+				m.ShortURL,
+				m.LongURL,
+				m.CreatedAt.UTC().Format(time.RFC3339),
+				strconv.Itoa(m.AccessCount),
+			})
+		}
+
+		if len(page.LastEvaluatedKey) == 0 {
+			break
+		}
+		w.Flush()
+		if buf.Len() >= exportMaxBytes {
+			nextCursor, err = encodeCursor(page.LastEvaluatedKey)
+			if err != nil {
+				return errorResponse(500, "Error encoding cursor"), err
+			}
+			break
+		}
+		input.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return errorResponse(500, "Error writing CSV"), err
+	}
+
+	headers := map[string]string{
+		"Content-Type":        "text/csv; charset=utf-8",
+		"Content-Disposition": `attachment; filename="urls.csv"`,
+	}
+	if nextCursor != "" {
+		headers["X-Next-Cursor"] = nextCursor
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    headers,
+		Body:       buf.String(),
+	}, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportCSV(t *testing.T) {
+	t.Run("header and escaping", func(t *testing.T) {
+		db := useFakeDB(t)
+		created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: `https://example.com/a,b?q="x"`, CreatedAt: created, AccessCount: 9})
+
+		response := serve(t, withAPIKey(newRequest("GET", "/api/export", "")))
+		if response.StatusCode != 200 || !strings.HasPrefix(response.Headers["Content-Type"], "text/csv") ||
+			!strings.HasPrefix(response.Headers["Content-Disposition"], "attachment") {
+			t.Fatalf("export = %d %v", response.StatusCode, response.Headers)
+		}
+		want := "short_url,long_url,created_at,access_count\n" +
+			`abc1234,"https://example.com/a,b?q=""x""",2024-03-01T09:30:00Z,9` + "\n"
+		if response.Body != want {
+			t.Fatalf("csv =\n%s\nwant\n%s", response.Body, want)
+		}
+	})
+
+	t.Run("pages across scans and responses", func(t *testing.T) {
+		db := useFakeDB(t)
+		db.pageSize = 100
+		const links = 1700 // About 3.4MB of CSV, so more than one response
+		for i := 0; i < links; i++ {
+			seedLink(t, db, URLMapping{ShortURL: fmt.Sprintf("code%05d", i), LongURL: "https://example.com/" + strings.Repeat("x", 2000)})
+		}
+
+		seen := map[string]bool{}
+		cursor, parts := "", 0
+		for {
+			path := "/api/export"
+			if cursor != "" {
+				path += "?cursor=" + cursor
+			}
+			response := serve(t, withAPIKey(newRequest("GET", path, "")))
+			rows, err := csv.NewReader(strings.NewReader(response.Body)).ReadAll()
+			if err != nil {
+				t.Fatalf("part %d: %v", parts, err)
+			}
+			if hasHeader := rows[0][0] == "short_url"; hasHeader != (parts == 0) {
+				t.Fatalf("part %d header row present = %v", parts, hasHeader)
+			}
+			if parts == 0 {
+				rows = rows[1:]
+			}
+			for _, row := range rows {
+				seen[row[0]] = true
+			}
+			parts++
+			cursor = response.Headers["X-Next-Cursor"]
+			if cursor == "" {
+				break
+			}
+		}
+		if parts < 2 || len(seen) != links {
+			t.Fatalf("%d parts covered %d links, want several parts covering %d", parts, len(seen), links)
+		}
+	})
+
+	t.Run("needs a key", func(t *testing.T) {
+		useFakeDB(t)
+		if response := serve(t, newRequest("GET", "/api/export", "")); response.StatusCode != 401 {
+			t.Fatalf("status = %d, want 401", response.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,735 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDB is an in-memory DynamoDBAPI. It understands the subset of the
+// expression language the handlers use, and applies each call under one lock
+// so conditional writes behave atomically as they do in DynamoDB.
+type fakeDB struct {
+	mu      sync.Mutex
+	tables  map[string]map[string]map[string]types.AttributeValue // table -> primary key -> item
+	schemas map[string][]string                                   // table or index -> hash key [, range key]
+	calls   map[string]int
+
+	// before, when set, runs ahead of every call; an error it returns is
+	// returned from the call without touching the tables
+	before func(ctx context.Context, op string, input any) error
+
+	getInputs []*dynamodb.GetItemInput
+
+	// pageSize, when set, caps every Scan and Query page the way DynamoDB's
+	// 1MB page limit does
+	pageSize int
+}
+
+// newFakeDB returns an empty fake that knows the key schema of every table
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		tables: map[string]map[string]map[string]types.AttributeValue{},
+		schemas: map[string][]string{
+			"urls":        {"short_url"},
+			"clicks":      {"short_url", "click_id"},
+			"quota":       {"quota_id"},
+			"ratelimit":   {"bucket_id"},
+			"idempotency": {"idempotency_key"},
+			"counters":    {"counter_id"},
+			longURLIndex:  {"long_url"},
+			aliasKeyIndex: {"alias_key"},
+			topLinksIndex: {"rank_key", "access_count"},
+		},
+		calls: map[string]int{},
+	}
+}
+
+// useFakeDB installs a fresh fake as the DynamoDB client for one test
+func useFakeDB(t *testing.T) *fakeDB {
+	t.Helper()
+	db := newFakeDB()
+	setVar[DynamoDBAPI](t, &ddbClient, db)
+	return db
+}
+
+// called returns how many times op has been called
+func (f *fakeDB) called(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// totalCalls returns how many calls of any kind have been made
+func (f *fakeDB) totalCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		n += c
+	}
+	return n
+}
+
+// enter records a call and runs the before hook outside the lock
+func (f *fakeDB) enter(ctx context.Context, op string, input any) error {
+	f.mu.Lock()
+	f.calls[op]++
+	before := f.before
+	f.mu.Unlock()
+	if before != nil {
+		return before(ctx, op, input)
+	}
+	return nil
+}
+
+// seed stores v, marshaled with attributevalue, in table
+func (f *fakeDB) seed(t *testing.T, table string, v any) {
+	t.Helper()
+	item, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		t.Fatalf("marshal seed item: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.put(table, item)
+}
+
+// mapping returns the stored mapping for shortURL, or nil
+func (f *fakeDB) mapping(t *testing.T, shortURL string) *URLMapping {
+	t.Helper()
+	item := f.item("urls", map[string]types.AttributeValue{"short_url": &types.AttributeValueMemberS{Value: shortURL}})
+	if item == nil {
+		return nil
+	}
+	var m URLMapping
+	if err := attributevalue.UnmarshalMap(item, &m); err != nil {
+		t.Fatalf("unmarshal stored item: %v", err)
+	}
+	return &m
+}
+
+// item returns a copy of the item stored under key, or nil
+func (f *fakeDB) item(table string, key map[string]types.AttributeValue) map[string]types.AttributeValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item := f.tables[table][f.keyOf(table, key)]
+	if item == nil {
+		return nil
+	}
+	return copyItem(item)
+}
+
+// items returns copies of every item in table, in key order
+func (f *fakeDB) items(table string) []map[string]types.AttributeValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []map[string]types.AttributeValue
+	for _, k := range f.sortedKeys(table) {
+		out = append(out, copyItem(f.tables[table][k]))
+	}
+	return out
+}
+
+func (f *fakeDB) keyOf(table string, item map[string]types.AttributeValue) string {
+	schema, ok := f.schemas[table]
+	if !ok {
+		schema = []string{"short_url"}
+	}
+	parts := make([]string, len(schema))
+	for i, name := range schema {
+		parts[i] = scalar(item[name])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func (f *fakeDB) put(table string, item map[string]types.AttributeValue) {
+	if f.tables[table] == nil {
+		f.tables[table] = map[string]map[string]types.AttributeValue{}
+	}
+	f.tables[table][f.keyOf(table, item)] = copyItem(item)
+}
+
+func (f *fakeDB) sortedKeys(table string) []string {
+	keys := make([]string, 0, len(f.tables[table]))
+	for k := range f.tables[table] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeDB) PutItem(ctx context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if err := f.enter(ctx, "PutItem", in); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table := *in.TableName
+	old := f.tables[table][f.keyOf(table, in.Item)]
+	if err := checkCondition(in.ConditionExpression, old, in.ExpressionAttributeNames, in.ExpressionAttributeValues, false); err != nil {
+		return nil, err
+	}
+	f.put(table, in.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDB) GetItem(ctx context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if err := f.enter(ctx, "GetItem", in); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.getInputs = append(f.getInputs, in)
+	item := f.tables[*in.TableName][f.keyOf(*in.TableName, in.Key)]
+	if item == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: project(copyItem(item), in.ProjectionExpression, in.ExpressionAttributeNames)}, nil
+}
+
+func (f *fakeDB) UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if err := f.enter(ctx, "UpdateItem", in); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table := *in.TableName
+	old := f.tables[table][f.keyOf(table, in.Key)]
+	if err := checkCondition(in.ConditionExpression, old, in.ExpressionAttributeNames, in.ExpressionAttributeValues,
+		in.ReturnValuesOnConditionCheckFailure == types.ReturnValuesOnConditionCheckFailureAllOld); err != nil {
+		return nil, err
+	}
+
+	item := copyItem(in.Key)
+	if old != nil {
+		item = copyItem(old)
+	}
+	if err := applyUpdate(item, *in.UpdateExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	f.put(table, item)
+
+	out := &dynamodb.UpdateItemOutput{}
+	if in.ReturnValues != types.ReturnValueNone && in.ReturnValues != "" {
+		out.Attributes = copyItem(item)
+	}
+	return out, nil
+}
+
+func (f *fakeDB) DeleteItem(ctx context.Context, in *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if err := f.enter(ctx, "DeleteItem", in); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table := *in.TableName
+	key := f.keyOf(table, in.Key)
+	old := f.tables[table][key]
+	if err := checkCondition(in.ConditionExpression, old, in.ExpressionAttributeNames, in.ExpressionAttributeValues, false); err != nil {
+		return nil, err
+	}
+	delete(f.tables[table], key)
+	out := &dynamodb.DeleteItemOutput{}
+	if in.ReturnValues == types.ReturnValueAllOld && old != nil {
+		out.Attributes = old
+	}
+	return out, nil
+}
+
+func (f *fakeDB) BatchWriteItem(ctx context.Context, in *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := f.enter(ctx, "BatchWriteItem", in); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for table, writes := range in.RequestItems {
+		for _, w := range writes {
+			switch {
+			case w.PutRequest != nil:
+				f.put(table, w.PutRequest.Item)
+			case w.DeleteRequest != nil:
+				delete(f.tables[table], f.keyOf(table, w.DeleteRequest.Key))
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (f *fakeDB) BatchGetItem(ctx context.Context, in *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if err := f.enter(ctx, "BatchGetItem", in); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{}}
+	for table, ka := range in.RequestItems {
+		for _, key := range ka.Keys {
+			if item := f.tables[table][f.keyOf(table, key)]; item != nil {
+				out.Responses[table] = append(out.Responses[table], copyItem(item))
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDB) Scan(ctx context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if err := f.enter(ctx, "Scan", in); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table := *in.TableName
+	var matched []map[string]types.AttributeValue
+	for _, k := range f.sortedKeys(table) {
+		matched = append(matched, f.tables[table][k])
+	}
+	page, last := f.page(table, table, matched, in.ExclusiveStartKey, in.Limit)
+	out := &dynamodb.ScanOutput{LastEvaluatedKey: last}
+	for _, item := range page {
+		out.Items = append(out.Items, project(copyItem(item), in.ProjectionExpression, in.ExpressionAttributeNames))
+	}
+	out.Count = int32(len(out.Items))
+	return out, nil
+}
+
+func (f *fakeDB) Query(ctx context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if err := f.enter(ctx, "Query", in); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table := *in.TableName
+	index := table
+	if in.IndexName != nil {
+		index = *in.IndexName
+	}
+	schema := f.schemas[index]
+
+	var matched []map[string]types.AttributeValue
+	for _, k := range f.sortedKeys(table) {
+		item := f.tables[table][k]
+		if in.IndexName != nil && !hasAll(item, schema) {
+			continue // Items without the index keys aren't in a GSI
+		}
+		ok, err := evalCondition(*in.KeyConditionExpression, item, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+	if len(schema) > 1 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return compare(matched[i][schema[1]], matched[j][schema[1]]) < 0
+		})
+	}
+	if in.ScanIndexForward != nil && !*in.ScanIndexForward {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	page, last := f.page(table, index, matched, in.ExclusiveStartKey, in.Limit)
+	out := &dynamodb.QueryOutput{LastEvaluatedKey: last}
+	for _, item := range page {
+		out.Items = append(out.Items, project(copyItem(item), in.ProjectionExpression, in.ExpressionAttributeNames))
+	}
+	out.Count = int32(len(out.Items))
+	return out, nil
+}
+
+// page applies ExclusiveStartKey and Limit to matched, returning the page and
+// its LastEvaluatedKey
+func (f *fakeDB) page(table, index string, matched []map[string]types.AttributeValue, start map[string]types.AttributeValue, limit *int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue) {
+	if len(start) > 0 {
+		startKey := f.keyOf(table, start)
+		for i, item := range matched {
+			if f.keyOf(table, item) == startKey {
+				matched = matched[i+1:]
+				break
+			}
+		}
+	}
+	n := len(matched)
+	if limit != nil {
+		n = min(n, int(*limit))
+	}
+	if f.pageSize > 0 {
+		n = min(n, f.pageSize)
+	}
+	if n == len(matched) {
+		return matched, nil
+	}
+	matched = matched[:n]
+	lastItem := matched[len(matched)-1]
+	last := map[string]types.AttributeValue{}
+	for _, name := range append(append([]string{}, f.schemas[table]...), f.schemas[index]...) {
+		if v, ok := lastItem[name]; ok {
+			last[name] = v
+		}
+	}
+	return matched, last
+}
+
+func (f *fakeDB) DescribeTable(ctx context.Context, in *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	if err := f.enter(ctx, "DescribeTable", in); err != nil {
+		return nil, err
+	}
+	return &dynamodb.DescribeTableOutput{Table: &types.TableDescription{
+		TableName:   in.TableName,
+		TableStatus: types.TableStatusActive,
+	}}, nil
+}
+
+func (f *fakeDB) CreateTable(ctx context.Context, in *dynamodb.CreateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	if err := f.enter(ctx, "CreateTable", in); err != nil {
+		return nil, err
+	}
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+// copyItem makes a shallow copy; attribute values are never mutated in place
+func copyItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	out := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		out[k] = v
+	}
+	return out
+}
+
+func hasAll(item map[string]types.AttributeValue, names []string) bool {
+	for _, name := range names {
+		if _, ok := item[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// scalar renders an S or N value as a string for keys and comparisons
+func scalar(v types.AttributeValue) string {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return v.Value
+	case *types.AttributeValueMemberBOOL:
+		return strconv.FormatBool(v.Value)
+	}
+	return ""
+}
+
+// compare orders two values, numerically when both are numbers
+func compare(a, b types.AttributeValue) int {
+	an, aok := a.(*types.AttributeValueMemberN)
+	bn, bok := b.(*types.AttributeValueMemberN)
+	if aok && bok {
+		x, _ := strconv.ParseFloat(an.Value, 64)
+		y, _ := strconv.ParseFloat(bn.Value, 64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(scalar(a), scalar(b))
+}
+
+// project keeps only the attributes named in a projection expression
+func project(item map[string]types.AttributeValue, projection *string, names map[string]string) map[string]types.AttributeValue {
+	if projection == nil {
+		return item
+	}
+	out := map[string]types.AttributeValue{}
+	for _, path := range strings.Split(*projection, ",") {
+		name := resolveName(strings.TrimSpace(path), names)
+		if v, ok := item[name]; ok {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+func resolveName(token string, names map[string]string) string {
+	if strings.HasPrefix(token, "#") {
+		return names[token]
+	}
+	return token
+}
+
+// operand resolves a :value or an attribute path against item
+func operand(token string, item map[string]types.AttributeValue, names map[string]string, values map[string]types.AttributeValue) (types.AttributeValue, bool) {
+	if strings.HasPrefix(token, ":") {
+		v, ok := values[token]
+		return v, ok
+	}
+	v, ok := item[resolveName(token, names)]
+	return v, ok
+}
+
+// checkCondition returns a ConditionalCheckFailedException unless item
+// satisfies condition; a nil condition always passes
+func checkCondition(condition *string, item map[string]types.AttributeValue, names map[string]string, values map[string]types.AttributeValue, returnOld bool) error {
+	if condition == nil {
+		return nil
+	}
+	ok, err := evalCondition(*condition, item, names, values)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		condErr := &types.ConditionalCheckFailedException{Message: strPtr("The conditional request failed")}
+		if returnOld && item != nil {
+			condErr.Item = copyItem(item)
+		}
+		return condErr
+	}
+	return nil
+}
+
+func strPtr(s string) *string { return &s }
+
+// tokenize splits an expression into names, values, operators and parentheses
+func tokenize(expr string) []string {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == ',':
+			if c == ',' {
+				tokens = append(tokens, ",")
+			}
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.ContainsRune("<>=", rune(c)):
+			j := i + 1
+			for j < len(expr) && strings.ContainsRune("<>=", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(expr) && !strings.ContainsRune(" ,()<>=", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+// evalCondition evaluates a condition or key condition expression. It
+// supports attribute_exists, attribute_not_exists, comparisons, BETWEEN,
+// AND, OR and parentheses, with AND binding tighter than OR.
+func evalCondition(expr string, item map[string]types.AttributeValue, names map[string]string, values map[string]types.AttributeValue) (bool, error) {
+	p := &condParser{tokens: tokenize(expr), item: item, names: names, values: values}
+	ok, err := p.or()
+	if err == nil && p.pos != len(p.tokens) {
+		err = fmt.Errorf("fake: unexpected %q in %q", p.tokens[p.pos], expr)
+	}
+	return ok, err
+}
+
+type condParser struct {
+	tokens []string
+	pos    int
+	item   map[string]types.AttributeValue
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func (p *condParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *condParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *condParser) or() (bool, error) {
+	left, err := p.and()
+	for err == nil && strings.EqualFold(p.peek(), "OR") {
+		p.next()
+		var right bool
+		right, err = p.and()
+		left = left || right
+	}
+	return left, err
+}
+
+func (p *condParser) and() (bool, error) {
+	left, err := p.term()
+	for err == nil && strings.EqualFold(p.peek(), "AND") {
+		p.next()
+		var right bool
+		right, err = p.term()
+		left = left && right
+	}
+	return left, err
+}
+
+func (p *condParser) term() (bool, error) {
+	tok := p.next()
+	switch tok {
+	case "(":
+		ok, err := p.or()
+		if p.next() != ")" {
+			return false, fmt.Errorf("fake: missing )")
+		}
+		return ok, err
+	case "attribute_exists", "attribute_not_exists":
+		if p.next() != "(" {
+			return false, fmt.Errorf("fake: expected ( after %s", tok)
+		}
+		_, exists := p.item[resolveName(p.next(), p.names)]
+		if p.next() != ")" {
+			return false, fmt.Errorf("fake: expected ) after %s", tok)
+		}
+		return exists == (tok == "attribute_exists"), nil
+	}
+
+	left, lok := operand(tok, p.item, p.names, p.values)
+	op := p.next()
+	if strings.EqualFold(op, "BETWEEN") {
+		low, _ := operand(p.next(), p.item, p.names, p.values)
+		if !strings.EqualFold(p.next(), "AND") {
+			return false, fmt.Errorf("fake: expected AND in BETWEEN")
+		}
+		high, _ := operand(p.next(), p.item, p.names, p.values)
+		return lok && compare(left, low) >= 0 && compare(left, high) <= 0, nil
+	}
+	right, rok := operand(p.next(), p.item, p.names, p.values)
+	if !lok || !rok {
+		return op == "<>", nil
+	}
+	c := compare(left, right)
+	switch op {
+	case "=":
+		return c == 0, nil
+	case "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("fake: unsupported operator %q", op)
+}
+
+// setOperand resolves the operand of a SET action starting at tokens[i],
+// including if_not_exists(path, value), and returns the index after it
+func setOperand(tokens []string, i int, item map[string]types.AttributeValue, names map[string]string, values map[string]types.AttributeValue) (types.AttributeValue, int, bool) {
+	if tokens[i] != "if_not_exists" {
+		v, ok := operand(tokens[i], item, names, values)
+		return v, i + 1, ok
+	}
+	if i+5 >= len(tokens) || tokens[i+1] != "(" || tokens[i+3] != "," || tokens[i+5] != ")" {
+		return nil, i, false
+	}
+	if v, ok := operand(tokens[i+2], item, names, values); ok {
+		return v, i + 6, true
+	}
+	v, ok := operand(tokens[i+4], item, names, values)
+	return v, i + 6, ok
+}
+
+// applyUpdate applies SET, ADD and REMOVE clauses to item
+func applyUpdate(item map[string]types.AttributeValue, expr string, names map[string]string, values map[string]types.AttributeValue) error {
+	tokens := tokenize(expr)
+	clause := ""
+	for i := 0; i < len(tokens); {
+		switch strings.ToUpper(tokens[i]) {
+		case "SET", "ADD", "REMOVE":
+			clause = strings.ToUpper(tokens[i])
+			i++
+			continue
+		case ",":
+			i++
+			continue
+		}
+
+		name := resolveName(tokens[i], names)
+		switch clause {
+		case "SET":
+			if i+2 >= len(tokens) || tokens[i+1] != "=" {
+				return fmt.Errorf("fake: bad SET in %q", expr)
+			}
+			v, next, ok := setOperand(tokens, i+2, item, names, values)
+			if !ok {
+				return fmt.Errorf("fake: unknown operand %q", tokens[i+2])
+			}
+			i = next
+			if i+1 < len(tokens) && (tokens[i] == "+" || tokens[i] == "-") {
+				right, next, ok := setOperand(tokens, i+1, item, names, values)
+				if !ok {
+					return fmt.Errorf("fake: unknown operand %q", tokens[i+1])
+				}
+				x, _ := strconv.ParseFloat(scalar(v), 64)
+				y, _ := strconv.ParseFloat(scalar(right), 64)
+				if tokens[i] == "-" {
+					y = -y
+				}
+				v = &types.AttributeValueMemberN{Value: strconv.FormatFloat(x+y, 'f', -1, 64)}
+				i = next
+			}
+			item[name] = v
+		case "ADD":
+			delta, _ := strconv.ParseFloat(scalar(values[tokens[i+1]]), 64)
+			current := 0.0
+			if n, ok := item[name].(*types.AttributeValueMemberN); ok {
+				current, _ = strconv.ParseFloat(n.Value, 64)
+			}
+			item[name] = &types.AttributeValueMemberN{Value: strconv.FormatFloat(current+delta, 'f', -1, 64)}
+			i += 2
+		case "REMOVE":
+			delete(item, name)
+			i++
+		default:
+			return fmt.Errorf("fake: no clause before %q in %q", tokens[i], expr)
+		}
+	}
+	return nil
+}
+
+func TestCreateThenRedirectAgainstFake(t *testing.T) {
+	db := useFakeDB(t)
+
+	created := createLink(t, `{"long_url":"https://example.com/page"}`)
+	if db.mapping(t, created.ShortURL) == nil {
+		t.Fatalf("mapping %q was not stored", created.ShortURL)
+	}
+
+	response := serve(t, newRequest("GET", "/"+created.ShortURL, ""))
+	if response.StatusCode != 302 || response.Headers["Location"] != "https://example.com/page" {
+		t.Fatalf("redirect = %d %q, want 302 to the long URL", response.StatusCode, response.Headers["Location"])
+	}
+}
+
+func TestFakeSatisfiesDynamoDBAPI(t *testing.T) {
+	var _ DynamoDBAPI = newFakeDB()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// handleHTTPAPIRequest is the Lambda handler for HTTP API (payload format 2.0) events.
+// It adapts the event to the REST API shape the router consumes and converts the
+// response back, so both front doors share the same handlers.
+func handleHTTPAPIRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	response, err := handleRequest(ctx, proxyRequestFromV2(request))
+	return v2ResponseFromProxy(response), err
+}
+
+// proxyRequestFromV2 normalizes an HTTP API request into a REST API request
+func proxyRequestFromV2(request events.APIGatewayV2HTTPRequest) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		Resource:              request.RouteKey,
+		Path:                  request.RawPath,
+		HTTPMethod:            request.RequestContext.HTTP.Method,
+		Headers:               request.Headers,
+		QueryStringParameters: request.QueryStringParameters,
+		PathParameters:        request.PathParameters,
+		StageVariables:        request.StageVariables,
+		Body:                  request.Body,
+		IsBase64Encoded:       request.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:  request.RequestContext.AccountID,
+			APIID:      request.RequestContext.APIID,
+			DomainName: request.RequestContext.DomainName,
+			RequestID:  request.RequestContext.RequestID,
+			Stage:      request.RequestContext.Stage,
+			HTTPMethod: request.RequestContext.HTTP.Method,
+			Path:       request.RequestContext.HTTP.Path,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  request.RequestContext.HTTP.SourceIP,
+				UserAgent: request.RequestContext.HTTP.UserAgent,
+			},
+			Authorizer: authorizerFromV2(request.RequestContext.Authorizer),
+		},
+	}
+}
+
+// authorizerFromV2 flattens an HTTP API authorizer into the REST API's map shape
+func authorizerFromV2(authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription) map[string]interface{} {
+	if authorizer == nil {
+		return nil
+	}
+
+	out := map[string]interface{}{}
+	for k, v := range authorizer.Lambda {
+		out[k] = v
+	}
+	if authorizer.JWT != nil {
+		claims := map[string]interface{}{}
+		for k, v := range authorizer.JWT.Claims {
+			claims[k] = v
+		}
+		out["claims"] = claims
+	}
+	if authorizer.IAM != nil && out["principalId"] == nil {
+		out["principalId"] = authorizer.IAM.UserARN
+	}
+	return out
+}
+
+// v2ResponseFromProxy converts a REST API response into an HTTP API response
+func v2ResponseFromProxy(response events.APIGatewayProxyResponse) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:        response.StatusCode,
+		Headers:           response.Headers,
+		MultiValueHeaders: response.MultiValueHeaders,
+		Body:              response.Body,
+		IsBase64Encoded:   response.IsBase64Encoded,
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHTTPAPIPayloadRoutesLikeRESTAPI(t *testing.T) {
+	useFakeDB(t)
+	v2 := func(method, path, body string) events.APIGatewayV2HTTPRequest {
+		v1 := newRequest(method, path, body)
+		request := events.APIGatewayV2HTTPRequest{
+			RawPath:               v1.Path,
+			Headers:               v1.Headers,
+			QueryStringParameters: v1.QueryStringParameters,
+			PathParameters:        v1.PathParameters,
+			Body:                  body,
+		}
+		request.RequestContext.HTTP.Method = method
+		request.RequestContext.HTTP.SourceIP = "203.0.113.7"
+		return request
+	}
+
+	created, err := handleHTTPAPIRequest(context.Background(), v2("POST", "/", `{"long_url":"https://example.com/v2"}`))
+	if err != nil || created.StatusCode != 201 {
+		t.Fatalf("v2 create = %d, %v", created.StatusCode, err)
+	}
+	var m URLMapping
+	if err := json.Unmarshal([]byte(created.Body), &m); err != nil {
+		t.Fatal(err)
+	}
+
+	redirect, err := handleHTTPAPIRequest(context.Background(), v2("GET", "/"+m.ShortURL, ""))
+	if err != nil || redirect.StatusCode != 302 || redirect.Headers["Location"] != "https://example.com/v2" {
+		t.Fatalf("v2 redirect = %d %q, %v", redirect.StatusCode, redirect.Headers["Location"], err)
+	}
+
+	// The same link resolves through a REST API payload too
+	if response := serve(t, newRequest("GET", "/"+m.ShortURL, "")); response.Headers["Location"] != "https://example.com/v2" {
+		t.Fatalf("v1 redirect Location = %q", response.Headers["Location"])
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Idempotency records map an Idempotency-Key header to the mapping it created,
+// so a retried create returns the original code instead of minting another.
+// The table is keyed by idempotency_key, the header scoped to the caller;
+// point its TTL at expires_at.
+var (
+	idempotencyTable = os.Getenv("IDEMPOTENCY_TABLE") // Idempotency keys are ignored when unset
+	idempotencyTTL   = time.Duration(envInt("IDEMPOTENCY_TTL_SECONDS", 86400)) * time.Second
+)
+
+// idempotencyRecord is the item stored in the idempotency table
+type idempotencyRecord struct {
+	IdempotencyKey string     `dynamodbav:"idempotency_key"`
+	Mapping        URLMapping `dynamodbav:"mapping"`
+	ExpiresAt      int64      `dynamodbav:"expires_at"`
+}
+
+// scopedIdempotencyKey qualifies a client's Idempotency-Key with its principal
+// and tenant, so two callers who pick the same key never see each other's link.
+// An empty key stays empty.
+func scopedIdempotencyKey(request events.APIGatewayProxyRequest, key string) string {
+	if key == "" {
+		return ""
+	}
+	return requestPrincipal(request) + "#" + requestTenant(request) + "#" + key
+}
+
+// getIdempotentMapping returns the mapping previously created with key, or nil
+func getIdempotentMapping(ctx context.Context, key string) (*URLMapping, error) {
+	result, err := ddbClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &idempotencyTable,
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var record idempotencyRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, err
+	}
+	// TTL deletion lags, so ignore records past their window
+	if time.Now().Unix() >= record.ExpiresAt {
+		return nil, nil
+	}
+	return &record.Mapping, nil
+}
+
+// saveIdempotentMapping remembers the mapping created for key.
+// If a concurrent request stored one first, that mapping is returned instead.
+func saveIdempotentMapping(ctx context.Context, key string, mapping URLMapping) (*URLMapping, error) {
+	item, err := attributevalue.MarshalMap(idempotencyRecord{
+		IdempotencyKey: key,
+		Mapping:        mapping,
+		ExpiresAt:      time.Now().Add(idempotencyTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ddbClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           &idempotencyTable,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(idempotency_key) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return getIdempotentMapping(ctx, key)
+		}
+		return nil, err
+	}
+	return &mapping, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIdempotencyKeyReplaysCreate(t *testing.T) {
+	db := useFakeDB(t)
+	setVar(t, &idempotencyTable, "idempotency")
+	body := `{"long_url":"https://example.com"}`
+	create := func(key, principal string) URLMapping {
+		t.Helper()
+		request := newRequest("POST", "/", body)
+		request.Headers["Idempotency-Key"] = key
+		if principal != "" {
+			request.RequestContext.Authorizer = map[string]interface{}{"principalId": principal}
+		}
+		response := serve(t, request)
+		if response.StatusCode != 201 {
+			t.Fatalf("create with key %q: status %d", key, response.StatusCode)
+		}
+		var m URLMapping
+		decode(t, response, &m)
+		return m
+	}
+
+	first := create("key-1", "")
+	if replay := create("key-1", ""); replay.ShortURL != first.ShortURL {
+		t.Fatalf("replay got %q, want %q", replay.ShortURL, first.ShortURL)
+	}
+	if other := create("key-2", ""); other.ShortURL == first.ShortURL {
+		t.Fatalf("a different key reused %q", first.ShortURL)
+	}
+	if stranger := create("key-1", "someone-else"); stranger.ShortURL == first.ShortURL {
+		t.Fatalf("another caller's key-1 replayed %q", first.ShortURL)
+	}
+	if n := len(db.items("urls")); n != 3 {
+		t.Fatalf("%d links stored, want 3", n)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// anonymousPrincipal is recorded when a request carries no identity
+const anonymousPrincipal = "anonymous"
+
+// requestPrincipal identifies who made a request, preferring the API Gateway
+// authorizer context over the x-api-key header. API keys are recorded as a
+// short fingerprint so the key itself never lands in the table.
+func requestPrincipal(request events.APIGatewayProxyRequest) string {
+	authorizer := request.RequestContext.Authorizer
+
+	// Lambda authorizers return a principalId
+	if principal, ok := authorizer["principalId"].(string); ok && principal != "" {
+		return principal
+	}
+
+	// Cognito and JWT authorizers expose the token claims
+	if claims, ok := authorizer["claims"].(map[string]interface{}); ok {
+		if sub, ok := claims["sub"].(string); ok && sub != "" {
+			return sub
+		}
+	}
+
+	if key := headerValue(request, "x-api-key"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "apikey:" + hex.EncodeToString(sum[:])[:12]
+	}
+
+	return anonymousPrincipal
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreatorIsRecorded(t *testing.T) {
+	t.Run("authorizer", func(t *testing.T) {
+		db := useFakeDB(t)
+		request := newRequest("POST", "/", `{"long_url":"https://example.com"}`)
+		request.RequestContext.Authorizer = map[string]interface{}{"principalId": "user-42"}
+		var created URLMapping
+		decode(t, serve(t, request), &created)
+		if got := db.mapping(t, created.ShortURL).CreatedBy; got != "user-42" {
+			t.Fatalf("stored created_by = %q", got)
+		}
+		var info URLMapping
+		decode(t, serve(t, newRequest("GET", "/api/"+created.ShortURL, "")), &info)
+		if info.CreatedBy != "user-42" {
+			t.Fatalf("metadata created_by = %q", info.CreatedBy)
+		}
+	})
+	t.Run("jwt claims", func(t *testing.T) {
+		request := newRequest("POST", "/", "")
+		request.RequestContext.Authorizer = map[string]interface{}{"claims": map[string]interface{}{"sub": "jwt-sub"}}
+		if got := requestPrincipal(request); got != "jwt-sub" {
+			t.Fatalf("principal = %q", got)
+		}
+	})
+	t.Run("api key", func(t *testing.T) {
+		got := requestPrincipal(newRequest("POST", "/", ""))
+		if !strings.HasPrefix(got, "apikey:") || strings.Contains(got, testAPIKey) {
+			t.Fatalf("principal = %q, want a key fingerprint", got)
+		}
+	})
+	t.Run("anonymous", func(t *testing.T) {
+		if got := requestPrincipal(newRequest("GET", "/", "")); got != anonymousPrincipal {
+			t.Fatalf("principal = %q, want %q", got, anonymousPrincipal)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxImportItems caps one import; each item is its own conditional write
+const maxImportItems = 100
+
+// Outcomes reported for each imported item
+const (
+	importImported = "imported"
+	importConflict = "conflict" // The code is already taken
+	importInvalid  = "invalid"  // The code or URL was rejected; see Error
+	importFailed   = "failed"   // The write itself failed
+)
+
+// ImportItem is one code→URL pair carried over from another shortener
+type ImportItem struct {
+	ShortURL string `json:"short_url"`
+	LongURL  string `json:"long_url"`
+}
+
+// ImportRequest represents the expected JSON structure for imports
+type ImportRequest struct {
+	URLs []ImportItem `json:"urls"`
+}
+
+// ImportResult reports the outcome for one imported item
+type ImportResult struct {
+	ShortURL string `json:"short_url"`
+	LongURL  string `json:"long_url"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportResponse is the body returned from an import
+type ImportResponse struct {
+	Results []ImportResult `json:"results"`
+}
+
+// importURLs handles POST /api/urls/import requests
+// Unlike a batch create, the codes are supplied by the caller and kept as
+// they are, so each item is written with a condition that the code is free.
+// Items are handled independently; a conflict or bad entry doesn't stop the rest.
+func importURLs(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err := requireJSONBody(request); err != nil {
+		return errorResponse(415, err.Error()), nil
+	}
+
+	var importReq ImportRequest
+	if err := json.Unmarshal([]byte(request.Body), &importReq); err != nil {
+		return errorResponse(400, "Invalid request body"), nil
+	}
+	if len(importReq.URLs) == 0 {
+		return errorResponse(400, "urls is required"), nil
+	}
+	if len(importReq.URLs) > maxImportItems {
+		return errorResponse(400, fmt.Sprintf("at most %d urls per import", maxImportItems)), nil
+	}
+
+	tenant := requestTenant(request)
+	if tenant != "" {
+		if err := validateCustomAlias(tenant); err != nil {
+			return errorResponse(400, "invalid tenant"), nil
+		}
+	}
+
+	results := make([]ImportResult, len(importReq.URLs))
+	now := time.Now()
+	createdBy := requestPrincipal(request)
+	for i, item := range importReq.URLs {
+		results[i] = ImportResult{ShortURL: item.ShortURL, LongURL: item.LongURL}
+		results[i].Status, results[i].Error = importItem(ctx, URLMapping{
+			ShortURL:  item.ShortURL,
+			LongURL:   item.LongURL,
+			CreatedAt: now,
+			Tenant:    tenant,
+			CreatedBy: createdBy,
+			RankKey:   newRankKey(),
+		})
+	}
+
+	return jsonResponse(200, ImportResponse{Results: results})
+}
+
+// importItem validates and stores one imported mapping, whose ShortURL and
+// LongURL are as supplied. It returns the item's status and any error message.
+func importItem(ctx context.Context, urlMapping URLMapping) (string, string) {
+	if err := validateCustomAlias(urlMapping.ShortURL); err != nil {
+		return importInvalid, err.Error()
+	}
+	longURL, err := cleanLongURL(urlMapping.LongURL)
+	if err != nil {
+		return importInvalid, longURLErrorMessage(err)
+	}
+
+	taken, err := caseVariantTaken(ctx, urlMapping.Tenant, urlMapping.ShortURL)
+	if err != nil {
+		loggerFrom(ctx).Error("Error checking imported code", slog.Any("error", err))
+		return importFailed, "Error querying DynamoDB"
+	}
+	if taken {
+		return importConflict, "short_url already in use"
+	}
+
+	urlMapping.setKey(mappingKey(urlMapping.Tenant, canonicalCode(urlMapping.ShortURL)))
+	urlMapping.LongURL = longURL
+	item, err := attributevalue.MarshalMap(urlMapping)
+	if err != nil {
+		return importFailed, "Error marshaling item"
+	}
+
+	// Every imported code is chosen by the caller, so each one is a custom
+	// alias against the caller's reservation quota
+	imported := false
+	if quotaTable != "" && maxAliasesPerKey > 0 {
+		quotaID := aliasQuotaID(urlMapping.CreatedBy)
+		_, err := takeQuota(ctx, quotaID, maxAliasesPerKey, 1)
+		if errors.Is(err, errQuotaExceeded) {
+			return importFailed, "custom alias limit reached"
+		}
+		if err != nil {
+			loggerFrom(ctx).Error("Error updating quota", slog.Any("error", err))
+			return importFailed, "Error updating quota"
+		}
+		// Hand the reservation back if the code turns out to be taken or the write fails
+		defer func() {
+			if !imported {
+				releaseQuota(ctx, quotaID, 1)
+			}
+		}()
+	}
+
+	// Imported links count against the tenant's quota like any other
+	if tenantQuotaEnabled(urlMapping.Tenant) {
+		quotaID := tenantQuotaID(urlMapping.Tenant)
+		_, err := takeQuota(ctx, quotaID, maxLinksPerTenant, 1)
+		if errors.Is(err, errQuotaExceeded) {
+			return importFailed, "tenant link limit reached"
+		}
+		if err != nil {
+			loggerFrom(ctx).Error("Error updating quota", slog.Any("error", err))
+			return importFailed, "Error updating quota"
+		}
+		defer func() {
+			if !imported {
+				releaseQuota(ctx, quotaID, 1)
+			}
+		}()
+	}
+
+	_, err = ddbClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           &tableName,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(short_url)"),
+	})
+	if err == nil {
+		imported = true
+		return importImported, ""
+	}
+
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return importConflict, "short_url already in use"
+	}
+	loggerFrom(ctx).Error("Error saving imported link", slog.String("short_code", urlMapping.ShortURL), slog.Any("error", err))
+	return importFailed, "Error saving to DynamoDB"
+}
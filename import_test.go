@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestImportURLs(t *testing.T) {
+	importURLs := func(t *testing.T, body string) (int, []ImportResult) {
+		t.Helper()
+		response := serve(t, newRequest("POST", "/api/urls/import", body))
+		var imported ImportResponse
+		if response.StatusCode == 200 {
+			decode(t, response, &imported)
+		}
+		return response.StatusCode, imported.Results
+	}
+
+	t.Run("clean import", func(t *testing.T) {
+		db := useFakeDB(t)
+		status, results := importURLs(t, `{"urls":[{"short_url":"promo24","long_url":"https://example.com/promo"},{"short_url":"docs","long_url":"https://example.com/docs"}]}`)
+		if status != 200 || len(results) != 2 || results[0].Status != importImported || results[1].Status != importImported {
+			t.Fatalf("import = %d %+v", status, results)
+		}
+		if got := serve(t, newRequest("GET", "/promo24", "")).Headers["Location"]; got != "https://example.com/promo" {
+			t.Fatalf("/promo24 redirects to %q", got)
+		}
+		if db.mapping(t, "docs").CreatedAt.IsZero() {
+			t.Fatal("imported link has no created_at")
+		}
+	})
+
+	t.Run("conflicting code", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "taken01", LongURL: "https://example.com/original"})
+		status, results := importURLs(t, `{"urls":[{"short_url":"taken01","long_url":"https://example.com/new"},{"short_url":"free01","long_url":"https://example.com/free"}]}`)
+		if status != 200 || results[0].Status != importConflict || results[1].Status != importImported {
+			t.Fatalf("import = %d %+v", status, results)
+		}
+		if got := db.mapping(t, "taken01").LongURL; got != "https://example.com/original" {
+			t.Fatalf("conflicting import overwrote taken01 with %q", got)
+		}
+	})
+
+	t.Run("invalid entries", func(t *testing.T) {
+		db := useFakeDB(t)
+		status, results := importURLs(t, `{"urls":[{"short_url":"bad code!","long_url":"https://example.com"},{"short_url":"api","long_url":"https://example.com"},{"short_url":"fine01","long_url":"ftp://example.com"}]}`)
+		if status != 200 || len(results) != 3 {
+			t.Fatalf("import = %d %+v", status, results)
+		}
+		for _, result := range results {
+			if result.Status != importInvalid || result.Error == "" {
+				t.Errorf("%s = %s %q, want invalid", result.ShortURL, result.Status, result.Error)
+			}
+		}
+		if db.called("PutItem") != 0 {
+			t.Fatalf("PutItem calls = %d for invalid entries", db.called("PutItem"))
+		}
+	})
+
+	t.Run("alias quota", func(t *testing.T) {
+		db := useFakeDB(t)
+		setVar(t, &quotaTable, "quota")
+		setVar(t, &maxAliasesPerKey, 2)
+		seedLink(t, db, URLMapping{ShortURL: "taken01", LongURL: "https://example.com/original"})
+
+		// The conflict hands its reservation back, so only the third import is over
+		status, results := importURLs(t, `{"urls":[{"short_url":"taken01","long_url":"https://example.com"},{"short_url":"one01","long_url":"https://example.com"},{"short_url":"two02","long_url":"https://example.com"},{"short_url":"three03","long_url":"https://example.com"}]}`)
+		if status != 200 {
+			t.Fatalf("import = %d", status)
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Status)
+		}
+		if want := "conflict,imported,imported,failed"; strings.Join(got, ",") != want {
+			t.Fatalf("statuses = %v, want %s", got, want)
+		}
+		if results[3].Error != "custom alias limit reached" || db.mapping(t, "three03") != nil {
+			t.Fatalf("over the limit = %+v", results[3])
+		}
+
+		// Imports and creates share the same reservations
+		if response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"four04"}`)); response.StatusCode != 403 {
+			t.Fatalf("create after the import = %d, want 403", response.StatusCode)
+		}
+	})
+
+	t.Run("too many", func(t *testing.T) {
+		useFakeDB(t)
+		items := make([]ImportItem, maxImportItems+1)
+		for i := range items {
+			items[i] = ImportItem{ShortURL: fmt.Sprintf("code%03d", i), LongURL: "https://example.com"}
+		}
+		body, _ := json.Marshal(ImportRequest{URLs: items})
+		if status, _ := importURLs(t, string(body)); status != 400 {
+			t.Fatalf("%d items = %d, want 400", len(items), status)
+		}
+	})
+}
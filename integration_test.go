@@ -0,0 +1,150 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The integration suite runs the handlers against DynamoDB Local, so
+// conditional writes and expressions are checked by DynamoDB itself:
+//
+//	docker run --rm -p 8000:8000 amazon/dynamodb-local
+//	go test -tags=integration ./...
+//
+// DYNAMODB_LOCAL_ENDPOINT points it somewhere other than localhost:8000.
+// Each test creates its own table and deletes it when it finishes.
+
+// localDynamoDB returns a client for DynamoDB Local with dummy credentials
+func localDynamoDB(t *testing.T) *dynamodb.Client {
+	t.Helper()
+	endpoint := os.Getenv("DYNAMODB_LOCAL_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:8000"
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local", Source: "integration"}, nil
+		})),
+	)
+	if err != nil {
+		t.Fatalf("load AWS config: %v", err)
+	}
+	return dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+	})
+}
+
+// useLocalTable creates a fresh mappings table in DynamoDB Local, installs a
+// client for it as ddbClient and deletes the table when the test ends
+func useLocalTable(t *testing.T) *dynamodb.Client {
+	t.Helper()
+	client := localDynamoDB(t)
+	setVar(t, &tableName, fmt.Sprintf("urls-%d", time.Now().UnixNano()))
+	setVar(t, &ddbClient, withRetry(withTimeout(client, dynamoDBTimeout), dynamoDBMaxAttempts))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := ensureTable(ctx, client); err != nil {
+		t.Fatalf("create table %s (is DynamoDB Local running?): %v", tableName, err)
+	}
+
+	name := tableName
+	t.Cleanup(func() {
+		if _, err := client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: &name}); err != nil {
+			t.Errorf("delete table %s: %v", name, err)
+		}
+	})
+	return client
+}
+
+func TestIntegrationCreateRedirectDelete(t *testing.T) {
+	useLocalTable(t)
+
+	created := createLink(t, `{"long_url":"https://example.com/page"}`)
+
+	redirect := serve(t, newRequest("GET", "/"+created.ShortURL, ""))
+	if redirect.StatusCode != 302 || redirect.Headers["Location"] != "https://example.com/page" {
+		t.Fatalf("redirect = %d %q, want 302 to the long URL", redirect.StatusCode, redirect.Headers["Location"])
+	}
+
+	var info URLMapping
+	decode(t, serve(t, newRequest("GET", "/api/"+created.ShortURL, "")), &info)
+	if info.AccessCount != 1 || info.LastAccessedAt == nil {
+		t.Fatalf("after one redirect access_count = %d, last_accessed_at = %v", info.AccessCount, info.LastAccessedAt)
+	}
+
+	if response := serve(t, newRequest("DELETE", "/api/"+created.ShortURL, "")); response.StatusCode != 204 {
+		t.Fatalf("delete = %d %s", response.StatusCode, response.Body)
+	}
+	if response := serve(t, newRequest("GET", "/"+created.ShortURL, "")); response.StatusCode != 410 {
+		t.Fatalf("redirect after delete = %d, want 410", response.StatusCode)
+	}
+	if response := serve(t, newRequest("DELETE", "/api/missing1", "")); response.StatusCode != 404 {
+		t.Fatalf("delete of an unknown code = %d, want 404", response.StatusCode)
+	}
+}
+
+func TestIntegrationConditionalCreateCollision(t *testing.T) {
+	useLocalTable(t)
+
+	t.Run("taken alias", func(t *testing.T) {
+		createLink(t, `{"long_url":"https://first.example","custom_alias":"launch"}`)
+		response := serve(t, newRequest("POST", "/", `{"long_url":"https://second.example","custom_alias":"launch"}`))
+		if response.StatusCode != 409 {
+			t.Fatalf("second create = %d, want 409", response.StatusCode)
+		}
+		if got := serve(t, newRequest("GET", "/launch", "")).Headers["Location"]; got != "https://first.example" {
+			t.Fatalf("/launch redirects to %q, want the first link", got)
+		}
+	})
+
+	t.Run("taken generated code", func(t *testing.T) {
+		createLink(t, `{"long_url":"https://other.example","custom_alias":"TAKEN01"}`)
+		setVar[CodeGenerator](t, &codeGenerator, &sequenceGenerator{codes: []string{"TAKEN01", "FRESH01"}})
+
+		created := createLink(t, `{"long_url":"https://example.com"}`)
+		if created.ShortURL != "FRESH01" {
+			t.Fatalf("short_url = %q, want the retried code FRESH01", created.ShortURL)
+		}
+		if got := serve(t, newRequest("GET", "/TAKEN01", "")).Headers["Location"]; got != "https://other.example" {
+			t.Fatalf("/TAKEN01 redirects to %q, want the original link", got)
+		}
+	})
+}
+
+func TestIntegrationEnsureTableIsIdempotent(t *testing.T) {
+	client := useLocalTable(t) // Creates the table through ensureTable
+
+	ctx := context.Background()
+	before, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &tableName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureTable(ctx, client); err != nil {
+		t.Fatalf("second ensureTable: %v", err)
+	}
+	after, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &tableName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second create would have replaced the table and its creation time
+	if !after.Table.CreationDateTime.Equal(*before.Table.CreationDateTime) || after.Table.TableStatus != types.TableStatusActive {
+		t.Fatalf("table changed: created %v then %v, status %s", before.Table.CreationDateTime, after.Table.CreationDateTime, after.Table.TableStatus)
+	}
+	if len(after.Table.GlobalSecondaryIndexes) == 0 || *after.Table.GlobalSecondaryIndexes[0].IndexName != longURLIndex {
+		t.Fatalf("indexes = %+v, want %s", after.Table.GlobalSecondaryIndexes, longURLIndex)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// interstitialPage shows where a link goes before the visitor follows it.
+// html/template escapes the destination for each context it appears in, but
+// it would also replace an href with a scheme other than http, https or
+// mailto, so Link is passed as a template.URL once the scheme is known good.
+var interstitialPage = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Leaving for {{.Host}}</title>
+</head>
+<body>
+<p>This link goes to:</p>
+<p><code>{{.Destination}}</code></p>
+<p><a href="{{.Link}}" rel="noopener noreferrer">Continue</a></p>
+</body>
+</html>
+`))
+
+// interstitialResponse renders the interstitial page for destination
+func interstitialResponse(destination string) (events.APIGatewayProxyResponse, error) {
+	// Anything that fails validation is left to the template's own filtering
+	var link any = destination
+	if validateLongURL(destination) == nil {
+		link = template.URL(destination)
+	}
+
+	var buf bytes.Buffer
+	err := interstitialPage.Execute(&buf, struct {
+		Host        string
+		Destination string
+		Link        any
+	}{
+		Host:        hostOf(destination),
+		Destination: destination,
+		Link:        link,
+	})
+	if err != nil {
+		return errorResponse(500, "Error rendering page"), err
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":  "text/html; charset=utf-8",
+			"Cache-Control": "no-cache",
+		},
+		Body: buf.String(),
+	}, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterstitialPage(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "evil001", LongURL: `https://example.com/?q="><script>alert(1)</script>`})
+	seedLink(t, db, URLMapping{ShortURL: "flag001", LongURL: "https://example.com/terms", Interstitial: true})
+
+	response := serve(t, newRequest("GET", "/evil001?preview=true", ""))
+	if response.StatusCode != 200 || !strings.HasPrefix(response.Headers["Content-Type"], "text/html") {
+		t.Fatalf("preview = %d %q", response.StatusCode, response.Headers["Content-Type"])
+	}
+	if strings.Contains(response.Body, "<script>") {
+		t.Fatalf("page contains a raw script tag:\n%s", response.Body)
+	}
+	if !strings.Contains(response.Body, "&lt;script&gt;") {
+		t.Fatalf("page doesn't show the escaped destination:\n%s", response.Body)
+	}
+
+	// The per-link flag shows the page without ?preview
+	response = serve(t, newRequest("GET", "/flag001", ""))
+	if response.StatusCode != 200 || !strings.Contains(response.Body, `href="https://example.com/terms"`) {
+		t.Fatalf("flagged link = %d\n%s", response.StatusCode, response.Body)
+	}
+
+	t.Run("allowed custom schemes keep their href", func(t *testing.T) {
+		setVar(t, &allowedSchemes, schemeSet("https,myapp"))
+		response, err := interstitialResponse("myapp://open/item/7")
+		if err != nil || !strings.Contains(response.Body, `href="myapp://open/item/7"`) {
+			t.Fatalf("interstitial = %v\n%s", err, response.Body)
+		}
+		response, _ = interstitialResponse("javascript:alert(1)")
+		if strings.Contains(response.Body, `href="javascript:`) {
+			t.Fatalf("javascript href survived:\n%s", response.Body)
+		}
+	})
+}
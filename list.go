@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	defaultListPageSize = 50  // Mappings per page when ?limit is absent
+	maxListPageSize     = 500 // Upper bound on ?limit
+)
+
+// ListURLsResponse is one page of the /api/urls listing
+type ListURLsResponse struct {
+	URLs       []URLMapping `json:"urls"`
+	NextCursor string       `json:"next_cursor,omitempty"` // Pass back as ?cursor= for the next page
+}
+
+// listURLs handles GET /api/urls requests
+// It scans one page of the table, continuing from ?cursor when given
+func listURLs(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	pageSize := defaultListPageSize
+	if raw := request.QueryStringParameters["limit"]; raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return errorResponse(400, "limit must be a positive integer"), nil
+		}
+		pageSize = min(n, maxListPageSize)
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName: &tableName,
+		Limit:     aws.Int32(int32(pageSize)),
+	}
+	if cursor := request.QueryStringParameters["cursor"]; cursor != "" {
+		startKey, err := decodeCursor(cursor)
+		if err != nil {
+			return errorResponse(400, "invalid cursor"), nil
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	result, err := ddbClient.Scan(ctx, input)
+	if err != nil {
+		return errorResponse(500, "Error scanning DynamoDB"), err
+	}
+
+	page := ListURLsResponse{URLs: []URLMapping{}}
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &page.URLs); err != nil {
+		return errorResponse(500, "Error unmarshaling item"), err
+	}
+	if len(result.LastEvaluatedKey) > 0 {
+		page.NextCursor, err = encodeCursor(result.LastEvaluatedKey)
+		if err != nil {
+			return errorResponse(500, "Error encoding cursor"), err
+		}
+	}
+
+	return jsonResponse(200, page)
+}
+
+// encodeCursor turns a DynamoDB LastEvaluatedKey into an opaque URL-safe token
+func encodeCursor(key map[string]types.AttributeValue) (string, error) {
+	var plain map[string]string
+	if err := attributevalue.UnmarshalMap(key, &plain); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(plain)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor reverses encodeCursor into an ExclusiveStartKey
+func decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var plain map[string]string
+	if err := json.Unmarshal(raw, &plain); err != nil {
+		return nil, err
+	}
+	return attributevalue.MarshalMap(plain)
+}
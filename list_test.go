@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestListURLsPages(t *testing.T) {
+	t.Run("empty table", func(t *testing.T) {
+		useFakeDB(t)
+		response := serve(t, withAPIKey(newRequest("GET", "/api/urls", "")))
+		if response.StatusCode != 200 || response.Body != `{"urls":[]}` {
+			t.Fatalf("list = %d %s", response.StatusCode, response.Body)
+		}
+	})
+
+	t.Run("first page and cursor", func(t *testing.T) {
+		db := useFakeDB(t)
+		for _, code := range []string{"aaa1111", "bbb2222", "ccc3333"} {
+			seedLink(t, db, URLMapping{ShortURL: code, LongURL: "https://example.com/" + code})
+		}
+
+		var first ListURLsResponse
+		decode(t, serve(t, withAPIKey(newRequest("GET", "/api/urls?limit=2", ""))), &first)
+		if len(first.URLs) != 2 || first.NextCursor == "" {
+			t.Fatalf("first page = %d urls, cursor %q", len(first.URLs), first.NextCursor)
+		}
+
+		var second ListURLsResponse
+		decode(t, serve(t, withAPIKey(newRequest("GET", "/api/urls?limit=2&cursor="+first.NextCursor, ""))), &second)
+		if len(second.URLs) != 1 || second.NextCursor != "" {
+			t.Fatalf("second page = %d urls, cursor %q", len(second.URLs), second.NextCursor)
+		}
+		seen := map[string]bool{}
+		for _, m := range append(first.URLs, second.URLs...) {
+			seen[m.ShortURL] = true
+		}
+		if len(seen) != 3 {
+			t.Fatalf("pages covered %v, want all three codes", seen)
+		}
+	})
+
+	t.Run("needs a key", func(t *testing.T) {
+		useFakeDB(t)
+		if response := serve(t, newRequest("GET", "/api/urls", "")); response.StatusCode != 401 {
+			t.Fatalf("status = %d, want 401", response.StatusCode)
+		}
+	})
+}
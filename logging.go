@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// loggerKey is the context key for the per-request logger
+type loggerKey struct{}
+
+// baseLogger writes JSON log records to stdout, which Lambda ships to CloudWatch
+var baseLogger = newJSONLogger(os.Stdout)
+
+// newJSONLogger creates a logger that emits one JSON object per record
+func newJSONLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, nil))
+}
+
+// requestLogger returns a logger tagged with the request ID, method and short code
+func requestLogger(base *slog.Logger, request events.APIGatewayProxyRequest) *slog.Logger {
+	l := base.With(
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("method", request.HTTPMethod),
+		slog.String("path", request.Path),
+	)
+	if shortURL := requestShortURL(request); shortURL != "" {
+		l = l.With(slog.String("short_code", shortURL))
+	}
+	return l
+}
+
+// withLogger stores a logger in the context for handlers further down
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the request logger from ctx, or baseLogger if there isn't one
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return baseLogger
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogsCarryStructuredKeys(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+	var buf bytes.Buffer
+	setVar(t, &baseLogger, newJSONLogger(&buf))
+
+	serve(t, newRequest("GET", "/abc1234", ""))
+
+	var redirect map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		if record["msg"] == "Request handled" {
+			redirect = record
+		}
+	}
+	if redirect == nil {
+		t.Fatalf("no summary record in %s", buf.String())
+	}
+	for _, key := range []string{"time", "level", "request_id", "method", "short_code", "status", "latency_ms"} {
+		if _, ok := redirect[key]; !ok {
+			t.Errorf("summary record has no %q: %v", key, redirect)
+		}
+	}
+	if redirect["request_id"] != "req-1" || redirect["short_code"] != "abc1234" {
+		t.Fatalf("summary record = %v", redirect)
+	}
+}
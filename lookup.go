@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// LookupResponse lists every short code pointing at one destination
+type LookupResponse struct {
+	LongURL string       `json:"long_url"`
+	URLs    []URLMapping `json:"urls"`
+}
+
+// lookupByLongURL handles GET /api/lookup?long_url= requests
+// It returns every mapping for the destination across all tenants, including
+// deleted and expired ones, since abuse reports care about those too
+func lookupByLongURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	raw := strings.TrimSpace(request.QueryStringParameters["long_url"])
+	if raw == "" {
+		return errorResponse(400, "long_url is required"), nil
+	}
+
+	// Normalize like a create so the GSI key matches what was stored, but skip
+	// the blocklist and private host checks: those are the links people report
+	longURL, err := normalizeURL(raw)
+	if err != nil {
+		return errorResponse(400, "invalid url"), nil
+	}
+
+	lookup := LookupResponse{LongURL: longURL, URLs: []URLMapping{}}
+	paginator := dynamodb.NewQueryPaginator(ddbClient, &dynamodb.QueryInput{
+		TableName:              &tableName,
+		IndexName:              &longURLIndex,
+		KeyConditionExpression: aws.String("long_url = :u"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":u": &types.AttributeValueMemberS{Value: longURL},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return errorResponse(500, "Error querying DynamoDB"), err
+		}
+
+		var mappings []URLMapping
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &mappings); err != nil {
+			return errorResponse(500, "Error unmarshaling item"), err
+		}
+		for _, m := range mappings {
+			m.ShortURLFull = fullShortURL(request, m.ShortURL)
+			lookup.URLs = append(lookup.URLs, m)
+		}
+	}
+
+	return jsonResponse(200, lookup)
+}
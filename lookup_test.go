@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLookupByLongURL(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "one0001", LongURL: "https://example.com/reported"})
+	seedLink(t, db, URLMapping{ShortURL: "two0002", LongURL: "https://example.com/reported"})
+	seedLink(t, db, URLMapping{ShortURL: "solo003", LongURL: "https://example.com/single"})
+
+	lookup := func(longURL string) string {
+		t.Helper()
+		response := serve(t, withAPIKey(newRequest("GET", "/api/lookup?long_url="+longURL, "")))
+		var body LookupResponse
+		decode(t, response, &body)
+		if response.StatusCode != 200 {
+			t.Fatalf("lookup %s = %d %s", longURL, response.StatusCode, response.Body)
+		}
+		var codes []string
+		for _, m := range body.URLs {
+			codes = append(codes, m.ShortURL)
+		}
+		sort.Strings(codes)
+		return strings.Join(codes, ",")
+	}
+
+	// The query is normalized like a create, so a differently-cased host still matches
+	if got := lookup("https://EXAMPLE.com/single"); got != "solo003" {
+		t.Fatalf("single match = %v", got)
+	}
+	if got := lookup("https://example.com/reported"); got != "one0001,two0002" {
+		t.Fatalf("two matches = %v", got)
+	}
+	if got := lookup("https://example.com/nothing"); got != "" {
+		t.Fatalf("no matches = %v", got)
+	}
+
+	if response := serve(t, newRequest("GET", "/api/lookup?long_url=https://example.com/single", "")); response.StatusCode != 401 {
+		t.Fatalf("lookup without a key = %d, want 401", response.StatusCode)
+	}
+}
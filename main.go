@@ -3,10 +3,24 @@ package main
 import (
 	// Standard library imports
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"mime"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	// AWS SDK imports
@@ -17,6 +31,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb" // DynamoDB client
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // URLMapping represents the structure of our DynamoDB items
@@ -25,192 +40,1961 @@ type URLMapping struct {
 	LongURL     string    `json:"long_url" dynamodbav:"long_url"`
 	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
 	AccessCount int       `json:"access_count" dynamodbav:"access_count"`
+	// LastAccessedAt is when the link last redirected; nil if it never has
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty" dynamodbav:"last_accessed_at,omitempty"`
+	// ExpiresAt is a Unix timestamp after which the link stops redirecting.
+	// Point the table's TTL attribute at expires_at so DynamoDB eventually
+	// removes expired items; expiry is also enforced on read because TTL
+	// deletion can lag by up to a couple of days.
+	ExpiresAt int64  `json:"expires_at,omitempty" dynamodbav:"expires_at,omitempty"`
+	Permanent bool   `json:"permanent" dynamodbav:"permanent"`               // Redirect with 301 instead of 302
+	Tenant    string `json:"tenant,omitempty" dynamodbav:"tenant,omitempty"` // Namespace the code belongs to, if any
+	// DeletedAt is the Unix time the link was soft-deleted; it can be restored
+	// until softDeleteRetention has passed
+	DeletedAt int64 `json:"deleted_at,omitempty" dynamodbav:"deleted_at,omitempty"`
+	// Preview metadata fetched from the destination when requested
+	PreviewTitle string `json:"preview_title,omitempty" dynamodbav:"preview_title,omitempty"`
+	PreviewImage string `json:"preview_image,omitempty" dynamodbav:"preview_image,omitempty"`
+	// ShortURLFull is the complete public link; it is filled in for responses and never stored
+	ShortURLFull string `json:"short_url_full,omitempty" dynamodbav:"-"`
+	// MaxClicks stops the link redirecting after this many uses; 0 means unlimited
+	MaxClicks int `json:"max_clicks,omitempty" dynamodbav:"max_clicks,omitempty"`
+	// UTM parameters merged into the destination's query string on redirect
+	UTMSource   string `json:"utm_source,omitempty" dynamodbav:"utm_source,omitempty"`
+	UTMMedium   string `json:"utm_medium,omitempty" dynamodbav:"utm_medium,omitempty"`
+	UTMCampaign string `json:"utm_campaign,omitempty" dynamodbav:"utm_campaign,omitempty"`
+	// CreatedBy is the principal that created the link, or "anonymous"
+	CreatedBy string `json:"created_by,omitempty" dynamodbav:"created_by,omitempty"`
+	// RankKey is the mapping's shard of the top links GSI
+	RankKey string `json:"-" dynamodbav:"rank_key,omitempty"`
+	// AliasKey is the lowercased short_url, so case variants of a code can be found
+	AliasKey string `json:"-" dynamodbav:"alias_key,omitempty"`
+	// RedirectCode overrides Permanent with an explicit 301, 302, 307 or 308
+	RedirectCode int `json:"redirect_code,omitempty" dynamodbav:"redirect_code,omitempty"`
+	// PasswordHash is the bcrypt hash of the link password; never returned to clients
+	PasswordHash string `json:"-" dynamodbav:"password_hash,omitempty"`
+	// Destinations splits traffic across weighted variants; LongURL is used when empty
+	Destinations []WeightedDestination `json:"destinations,omitempty" dynamodbav:"destinations,omitempty"`
+	// GeoDestinations maps ISO country codes to their own destination
+	GeoDestinations map[string]string `json:"geo_destinations,omitempty" dynamodbav:"geo_destinations,omitempty"`
+	// App store links for mobile visitors; everyone else gets the usual destination
+	IOSURL     string `json:"ios_url,omitempty" dynamodbav:"ios_url,omitempty"`
+	AndroidURL string `json:"android_url,omitempty" dynamodbav:"android_url,omitempty"`
+	// RedirectHeaders are extra headers sent with the redirect, e.g. Referrer-Policy
+	RedirectHeaders map[string]string `json:"redirect_headers,omitempty" dynamodbav:"redirect_headers,omitempty"`
+	// WebhookURL is told about every click; it often embeds a secret, so it is never returned
+	WebhookURL string `json:"-" dynamodbav:"webhook_url,omitempty"`
+	// Interstitial shows a page naming the destination instead of redirecting straight away
+	Interstitial bool `json:"interstitial,omitempty" dynamodbav:"interstitial,omitempty"`
+	// Enabled false pauses the link without deleting it; items without it are enabled
+	Enabled *bool `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+	// Fragment is the #anchor added to the destination on redirect; browsers
+	// never send fragments to the server, so it has to be stored
+	Fragment string `json:"fragment,omitempty" dynamodbav:"fragment,omitempty"`
 }
 
 // CreateURLRequest represents the expected JSON structure for POST requests
 type CreateURLRequest struct {
-	LongURL string `json:"long_url"`
+	LongURL          string `json:"long_url"`
+	CustomAlias      string `json:"custom_alias,omitempty"`       // Optional user-chosen short code
+	ExpiresInSeconds int64  `json:"expires_in_seconds,omitempty"` // Optional lifetime of the link
+	Permanent        bool   `json:"permanent,omitempty"`          // Opt in to a cacheable 301 redirect
+	RedirectCode     int    `json:"redirect_code,omitempty"`      // One of 301, 302, 307 or 308
+	ReuseExisting    bool   `json:"reuse_existing,omitempty"`     // Return an existing code for the same long URL
+	Password         string `json:"password,omitempty"`           // Optional password required to follow the link
+	FetchMetadata    bool   `json:"fetch_metadata,omitempty"`     // Store the destination's title and og:image
+	VerifyReachable  bool   `json:"verify_reachable,omitempty"`   // Refuse destinations that error or time out
+	MaxClicks        int    `json:"max_clicks,omitempty"`         // Optional cap on redirects, e.g. 1 for single-use links
+	UTMSource        string `json:"utm_source,omitempty"`         // Campaign tracking added on redirect
+	UTMMedium        string `json:"utm_medium,omitempty"`
+	UTMCampaign      string `json:"utm_campaign,omitempty"`
+	// Optional A/B split; long_url defaults to the first destination
+	Destinations []WeightedDestination `json:"destinations,omitempty"`
+	// Optional per-country destinations, e.g. {"DE": "https://example.de"}
+	GeoDestinations map[string]string `json:"geo_destinations,omitempty"`
+	IOSURL          string            `json:"ios_url,omitempty"`          // Destination for iPhone, iPad and iPod visitors
+	AndroidURL      string            `json:"android_url,omitempty"`      // Destination for Android visitors
+	RedirectHeaders map[string]string `json:"redirect_headers,omitempty"` // Extra headers for the redirect response
+	WebhookURL      string            `json:"webhook_url,omitempty"`      // https URL POSTed to on every click
+	Interstitial    bool              `json:"interstitial,omitempty"`     // Always show the destination before redirecting
+	Fragment        string            `json:"fragment,omitempty"`         // Anchor to jump to, with or without the leading #
+}
+
+// DynamoDBAPI is the subset of the DynamoDB client the handlers use
+// *dynamodb.Client satisfies it; tests can swap in an in-memory fake
+type DynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
 }
 
 // Global variables
 var (
 	tableName = os.Getenv("DYNAMODB_TABLE") // DynamoDB table name from environment variable
-	ddbClient *dynamodb.Client              //Dynamodb client instance
+	// GSI keyed on long_url (projecting all attributes) used to reuse existing codes
+	longURLIndex = envOrDefault("LONG_URL_INDEX", "long_url-index")
+	// GSI keyed on alias_key used to refuse aliases that differ only by case
+	aliasKeyIndex = envOrDefault("ALIAS_KEY_INDEX", "alias_key-index")
+	// Public base of short links, e.g. https://short.example.com.
+	// When unset it is derived from the request's Host header.
+	shortURLBase = os.Getenv("SHORT_URL_BASE")
+	// Landing page unknown codes redirect to instead of a 404, if set
+	notFoundRedirect = os.Getenv("NOT_FOUND_REDIRECT")
+	// "This link has expired" page recently expired links redirect to instead
+	// of a 410, for EXPIRED_GRACE_SECONDS after they expire
+	expiredRedirect    = os.Getenv("EXPIRED_REDIRECT_URL")
+	expiredGracePeriod = time.Duration(envInt("EXPIRED_GRACE_SECONDS", 7*24*60*60)) * time.Second
+	// Page disabled links redirect to instead of a 403, if set
+	disabledRedirect = os.Getenv("DISABLED_REDIRECT_URL")
+	// Host of this shortener, used to refuse links that point back at it
+	selfDomain = hostOf(os.Getenv("SELF_DOMAIN"))
+	// Largest request body accepted, in bytes
+	maxBodyBytes = envInt("MAX_BODY_BYTES", 64<<10)
+	// Longest destination URL accepted, in bytes
+	maxLongURLLength = envInt("MAX_LONG_URL_LENGTH", 2048)
+	// Seconds browsers and CDNs may cache a 301 or 308 redirect
+	permanentRedirectMaxAge = envInt("PERMANENT_REDIRECT_MAX_AGE", 86400)
+	// Destinations that may not be shortened, including their subdomains
+	blockedDomains = domainSet(os.Getenv("BLOCKED_DOMAINS"))
+	// Origin allowed to call the API from a browser
+	corsAllowedOrigin = envOrDefault("CORS_ALLOWED_ORIGIN", "*")
+	// Store and look up codes in lowercase; this shrinks the code space from base62 to base36
+	caseInsensitiveCodes = os.Getenv("CASE_INSENSITIVE_CODES") == "true"
+	// How long a soft-deleted link can still be restored
+	softDeleteRetention = time.Duration(envInt("SOFT_DELETE_RETENTION_DAYS", 30)) * 24 * time.Hour
+	// Comma-separated keys accepted in the x-api-key header for writes
+	apiKeys = splitList(os.Getenv("API_KEYS"))
+	// Schemes destinations may use, e.g. "https" or "https,mailto,tel,myapp"
+	allowedSchemes = schemeSet(envOrDefault("ALLOWED_SCHEMES", "http,https"))
+	// Allow destinations on loopback, private and link-local addresses, for internal deployments
+	allowPrivateHosts = os.Getenv("ALLOW_PRIVATE_HOSTS") == "true"
+	// Length of generated short codes; longer codes make collisions rarer
+	shortCodeLength = envShortCodeLength()
+	// Characters generated codes are drawn from
+	shortCodeCharset = envShortCodeCharset()
+	// Limit custom aliases to shortCodeCharset as well
+	strictAliasCharset = os.Getenv("STRICT_ALIAS_CHARSET") == "true"
+	// Read mappings with strongly consistent reads, so a link resolves the moment
+	// it is created; each read then costs twice the RCUs
+	consistentReads = os.Getenv("CONSISTENT_READS") == "true"
+	ddbClient       DynamoDBAPI //Dynamodb client instance
+
+)
 
+const (
+	// Crockford's base32 drops I, L, O and U, so printed codes can't be misread
+	defaultShortCodeCharset = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	defaultShortCodeLength  = 7 // Length of generated short codes unless SHORT_CODE_LENGTH says otherwise
+	minShortCodeLength      = 4
+	maxShortCodeLength      = 16
+	maxCreateAttempts       = 5 // How many codes to try before giving up on a create
 )
 
+// supportedMethods are the HTTP methods routeRequest handles, plus OPTIONS for CORS
+// Keep this in step with the router; it feeds the Allow and CORS headers.
+var supportedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// allowedRedirectCodes are the redirect statuses a link may use
+// 307 and 308 keep the request method and body, unlike 301 and 302
+var allowedRedirectCodes = map[int]bool{
+	301: true,
+	302: true,
+	307: true,
+	308: true,
+}
+
+// Errors from cleanLongURL that get their own client-facing message
+var (
+	errSelfReferential = errors.New("url points at this shortener")
+	errBlockedDomain   = errors.New("domain is blocked")
+	errURLTooLong      = errors.New("url is too long")
+	errPrivateHost     = errors.New("url points at a private address")
+)
+
+// forbiddenSchemes run code or read local files in the browser, so they are
+// refused even if ALLOWED_SCHEMES lists them
+var forbiddenSchemes = map[string]bool{
+	"javascript": true,
+	"vbscript":   true,
+	"data":       true,
+	"file":       true,
+}
+
+// shortCodePattern is the format every short code, generated or custom, must match
+var shortCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+// reservedAliases can't be used as custom aliases because they clash with routes.
+// That includes every fixed name under /api, e.g. /api/urls, which would
+// otherwise shadow the metadata and delete routes of a link with that alias.
+var reservedAliases = map[string]bool{
+	"health":    true,
+	"api":       true,
+	"admin":     true,
+	"urls":      true,
+	"export":    true,
+	"lookup":    true,
+	"available": true,
+	"stats":     true,
+}
+
+// envOrDefault returns the value of the environment variable key, or def when unset
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envShortCodeLength reads SHORT_CODE_LENGTH, falling back to the default
+// when it is unset or outside minShortCodeLength..maxShortCodeLength
+func envShortCodeLength() int {
+	raw := os.Getenv("SHORT_CODE_LENGTH")
+	if raw == "" {
+		return defaultShortCodeLength
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < minShortCodeLength || n > maxShortCodeLength {
+		baseLogger.Warn("Ignoring invalid SHORT_CODE_LENGTH",
+			slog.String("value", raw),
+			slog.Int("min", minShortCodeLength),
+			slog.Int("max", maxShortCodeLength),
+			slog.Int("default", defaultShortCodeLength),
+		)
+		return defaultShortCodeLength
+	}
+	return n
+}
+
+// envShortCodeCharset reads SHORT_CODE_CHARSET, falling back to the default
+// when it is unset or invalid. In case-insensitive mode the charset is
+// lowercased, since codes are stored that way.
+func envShortCodeCharset() string {
+	charset := os.Getenv("SHORT_CODE_CHARSET")
+	if charset == "" {
+		charset = defaultShortCodeCharset
+	}
+	if caseInsensitiveCodes {
+		charset = strings.ToLower(charset)
+	}
+	if err := validateCharset(charset); err != nil {
+		baseLogger.Warn("Ignoring invalid SHORT_CODE_CHARSET", slog.String("value", charset), slog.Any("error", err))
+		charset = defaultShortCodeCharset
+		if caseInsensitiveCodes {
+			charset = strings.ToLower(charset)
+		}
+	}
+	return charset
+}
+
+// validateCharset checks that a code charset has at least two distinct
+// characters, all of them allowed in a short code
+func validateCharset(charset string) error {
+	if len(charset) < 2 {
+		return errors.New("charset needs at least two characters")
+	}
+	seen := map[rune]bool{}
+	for _, c := range charset {
+		if !shortCodePattern.MatchString(strings.Repeat(string(c), 3)) {
+			return fmt.Errorf("character %q can't appear in a short code", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("character %q is repeated", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value, dropping blanks and surrounding spaces
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// schemeSet parses a comma-separated list of URL schemes into a lookup set
+func schemeSet(raw string) map[string]bool {
+	set := map[string]bool{}
+	for _, scheme := range splitList(raw) {
+		set[strings.ToLower(strings.TrimSuffix(scheme, ":"))] = true
+	}
+	return set
+}
+
+// domainSet parses a comma-separated list of domains into a lookup set
+func domainSet(raw string) map[string]bool {
+	set := map[string]bool{}
+	for _, domain := range splitList(raw) {
+		if host := hostOf(domain); host != "" {
+			set[host] = true
+		}
+	}
+	return set
+}
+
 //init is called automatically when lambda starts up
-//Initializes dynamodb client
 
 func init() {
+	slog.SetDefault(baseLogger)
+}
+
+// clientMu guards the lazy setup of ddbClient
+var clientMu sync.Mutex
+
+// getClient returns the DynamoDB client, creating it on first use.
+// A config error is returned rather than exiting, so the request that hit it
+// gets a 500 and the next one tries again.
+func getClient(ctx context.Context) (DynamoDBAPI, error) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if ddbClient != nil {
+		return ddbClient, nil
+	}
+
 	//Load AWS configuration from environment or credentials file
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("loading AWS config: %w", err)
 	}
 
 	//create DynamoDB client
-	ddbClient = dynamodb.NewFromConfig(cfg)
+	// Set AWS_ENDPOINT_URL_DYNAMODB (e.g. http://localhost:8000) to run against DynamoDB Local
+	client := withTracing(withRetry(withTimeout(dynamodb.NewFromConfig(cfg), dynamoDBTimeout), dynamoDBMaxAttempts))
+
+	ddbClient = client
+	return ddbClient, nil
 }
 
 // handleRequest is the main Lambda handler function
-// It routes requests based on HTTP method
+// It routes the request and adds CORS headers to whatever comes back
 func handleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Answer CORS preflight requests directly
+	if request.HTTPMethod == "OPTIONS" {
+		return withCORS(events.APIGatewayProxyResponse{StatusCode: 204}), nil
+	}
+
+	start := time.Now()
+	tc := newTraceContext(request)
+	l := requestLogger(baseLogger, request).With(
+		slog.String("trace_id", tc.TraceID),
+		slog.String("span_id", tc.SpanID),
+	)
+	ctx = withLogger(withTraceContext(ctx, tc), l)
+	ctx, redirected := withRedirectFlag(ctx)
+
+	ctx, endTrace := startTrace(ctx, request)
+	response, err := routeVersioned(ctx, request)
+	endTrace(err)
+	response = withTimeFormat(request, response)
+
+	// A DynamoDB call ran out of time; report it as a gateway timeout
+	if errors.Is(err, context.DeadlineExceeded) {
+		l.Error("DynamoDB call timed out", slog.Any("error", err))
+		response, err = errorResponse(504, "Upstream request timed out"), nil
+	}
+
+	if metric := metricForResponse(request.HTTPMethod, response.StatusCode, redirected()); metric != "" {
+		emitMetric(metric, request.HTTPMethod)
+	}
+
+	// One summary line per request, at error level for failures
+	attrs := []any{
+		slog.Int("status", response.StatusCode),
+		slog.Int64("latency_ms", time.Since(start).Milliseconds()),
+	}
+	if err != nil || response.StatusCode >= 500 {
+		l.Error("Request failed", append(attrs, slog.Any("error", err))...)
+	} else {
+		l.Info("Request handled", attrs...)
+	}
+
+	// Give click and webhook writes a chance to land before Lambda freezes us
+	flushBackground(l, backgroundFlushTimeout)
+
+	// API Gateway turns a handler error into a bare 502 and drops the body,
+	// so the failure is reported through the response alone. It was logged above.
+	if err != nil && response.StatusCode < 500 {
+		response = errorResponse(500, "Internal server error")
+	}
+	return withCORS(response), nil
+}
+
+// routeRequest dispatches a request based on HTTP method and path
+func routeRequest(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	segments := pathSegments(request.Path)
+
+	// Every route below may touch DynamoDB, so fail cleanly when it can't be set up
+	if _, err := getClient(ctx); err != nil {
+		loggerFrom(ctx).Error("Error initializing DynamoDB client", slog.Any("error", err))
+		return errorResponse(500, "Service is not configured correctly"), nil
+	}
+
+	if !validTimeFormat(request.QueryStringParameters["time_format"]) {
+		return errorResponse(400, "time_format must be rfc3339 or epoch"), nil
+	}
+
+	// Refuse oversized bodies before anything tries to decode them
+	if requestBodySize(request) > maxBodyBytes {
+		return errorResponse(413, fmt.Sprintf("request body must be at most %d bytes", maxBodyBytes)), nil
+	}
+
+	// API Gateway base64-encodes bodies it treats as binary; handlers expect plain text
+	if request.IsBase64Encoded {
+		body, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return errorResponse(400, "request body is not valid base64"), nil
+		}
+		request.Body = string(body)
+		request.IsBase64Encoded = false
+	}
+
+	// Writes need an API key; redirects and lookups stay public
+	switch request.HTTPMethod {
+	case "POST", "PUT", "PATCH", "DELETE":
+		if err := requireAPIKey(request); err != nil {
+			return errorResponse(401, err.Error()), nil
+		}
+	}
+
 	switch request.HTTPMethod {
 	case "POST":
+		// Throttle creates per client IP. A dry-run create never touches
+		// DynamoDB, so it skips the limiter's write too; the /api/x/y
+		// endpoints don't have dry runs and are always throttled
+		dryRunCreate := request.QueryStringParameters["dry_run"] == "true" && !(len(segments) == 3 && segments[0] == "api")
+		if !dryRunCreate {
+			retryAfter, err := takeRateLimitToken(ctx, request.RequestContext.Identity.SourceIP, time.Now())
+			if errors.Is(err, errRateLimited) {
+				response := errorResponse(429, "Too many requests")
+				response.Headers["Retry-After"] = strconv.Itoa(retryAfter)
+				return response, nil
+			}
+			if err != nil {
+				// Don't turn a limiter outage into an API outage
+				loggerFrom(ctx).Error("Error checking rate limit", slog.Any("error", err))
+			}
+		}
+		if len(segments) == 3 && segments[0] == "api" && segments[1] == "urls" && segments[2] == "batch" {
+			return createBatch(ctx, request) //Handle bulk URL creation
+		}
+		if len(segments) == 3 && segments[0] == "api" && segments[1] == "urls" && segments[2] == "resolve" {
+			return resolveURLs(ctx, request) //Handle bulk lookups
+		}
+		if len(segments) == 3 && segments[0] == "api" && segments[1] == "urls" && segments[2] == "import" {
+			return importURLs(ctx, request) //Handle migrating links with their existing codes
+		}
+		if len(segments) == 3 && segments[0] == "api" && segments[2] == "restore" {
+			return restoreShortURL(ctx, request) //Handle undoing a delete
+		}
+		if len(segments) == 3 && segments[0] == "api" && segments[2] == "regenerate" {
+			return regenerateShortURL(ctx, request) //Handle moving a link to a new code
+		}
 		return createShortURL(ctx, request) //Handle URL creation
 	case "GET":
+		// Match /health before anything that treats the path as a short code
+		if len(segments) == 1 && segments[0] == "health" {
+			return healthCheck(ctx, request)
+		}
+		if len(segments) == 2 && segments[0] == "api" && segments[1] == "urls" {
+			// Listing exposes every mapping, so it needs a key like a write
+			if err := requireAPIKey(request); err != nil {
+				return errorResponse(401, err.Error()), nil
+			}
+			return listURLs(ctx, request)
+		}
+		if len(segments) == 2 && segments[0] == "api" && segments[1] == "export" {
+			if err := requireAPIKey(request); err != nil {
+				return errorResponse(401, err.Error()), nil
+			}
+			return exportCSV(ctx, request)
+		}
+		if len(segments) == 2 && segments[0] == "api" && segments[1] == "lookup" {
+			if err := requireAPIKey(request); err != nil {
+				return errorResponse(401, err.Error()), nil
+			}
+			return lookupByLongURL(ctx, request)
+		}
+		if len(segments) == 3 && segments[0] == "api" && segments[1] == "available" {
+			return checkAliasAvailable(ctx, request, segments[2])
+		}
+		if len(segments) == 3 && segments[0] == "api" && segments[1] == "stats" && segments[2] == "top" {
+			// Rankings list every destination and may fall back to a full scan
+			if err := requireAPIKey(request); err != nil {
+				return errorResponse(401, err.Error()), nil
+			}
+			return getTopLinks(ctx, request)
+		}
+		if len(segments) == 3 && segments[0] == "api" && segments[2] == "qr" {
+			return getQRCode(ctx, request)
+		}
+		if len(segments) == 3 && segments[0] == "api" && (segments[2] == "clicks" || segments[2] == "stats") {
+			// Click analytics carry visitors' referers, so they need a key like the listing
+			if err := requireAPIKey(request); err != nil {
+				return errorResponse(401, err.Error()), nil
+			}
+			if segments[2] == "clicks" {
+				return getClickSeries(ctx, request)
+			}
+			return getClickStats(ctx, request)
+		}
+		// /api/{shortURL} and ?info=true return metadata instead of redirecting
+		if (len(segments) == 2 && segments[0] == "api") || request.QueryStringParameters["info"] == "true" {
+			return getURLInfo(ctx, request)
+		}
 		return getOriginalURL(ctx, request) //Handle URL redirection
+	case "PUT":
+		if len(segments) == 2 && segments[0] == "api" {
+			return updateShortURL(ctx, request) //Handle repointing a short URL
+		}
+		return errorResponse(404, "Not found"), nil
+	case "PATCH":
+		if len(segments) == 2 && segments[0] == "api" {
+			return patchShortURL(ctx, request) //Handle pausing or resuming a short URL
+		}
+		return errorResponse(404, "Not found"), nil
+	case "DELETE":
+		if len(segments) == 2 && segments[0] == "api" && segments[1] == "urls" {
+			return purgeURLs(ctx, request) //Handle bulk removal
+		}
+		return deleteShortURL(ctx, request) //Handle URL removal
 	default:
-		return events.APIGatewayProxyResponse{
-			StatusCode: 405,
-			Body:       "Method not allowed",
-		}, nil
+		response := errorResponse(405, "Method not allowed")
+		response.Headers["Allow"] = strings.Join(supportedMethods, ", ")
+		return response, nil
 	}
 }
 
 // createShortURL handles POST requests to create new short URLs
 func createShortURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	// Parse the JSON request body
+	// ?dry_run=true validates and generates a code but never reads or writes DynamoDB
+	dryRun := request.QueryStringParameters["dry_run"] == "true"
+
+	// Simple HTML forms can only post form-encoded bodies, so accept those too
+	isForm := requestMediaType(request) == "application/x-www-form-urlencoded"
+	if err := requireJSONBody(request); err != nil && !isForm {
+		return errorResponse(415, "Content-Type must be application/json or application/x-www-form-urlencoded"), nil
+	}
+
+	// Replay the original response for a retried request
+	idempotencyKey := ""
+	if idempotencyTable != "" && !dryRun {
+		idempotencyKey = scopedIdempotencyKey(request, headerValue(request, "Idempotency-Key"))
+	}
+	if idempotencyKey != "" {
+		previous, err := getIdempotentMapping(ctx, idempotencyKey)
+		if err != nil {
+			return errorResponse(500, "Error querying DynamoDB"), err
+		}
+		if previous != nil {
+			previous.ShortURLFull = fullShortURL(request, previous.ShortURL)
+			return createdResponse(*previous)
+		}
+	}
+
+	// Parse the JSON or form request body
 	var createReq CreateURLRequest
-	err := json.Unmarshal([]byte(request.Body), &createReq)
+	var err error
+	if isForm {
+		createReq, err = createRequestFromForm(request.Body)
+	} else {
+		err = json.Unmarshal([]byte(request.Body), &createReq)
+	}
 	if err != nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 400,
-			Body:       "Invalid request body",
-		}, nil
+		return errorResponse(400, "Invalid request body"), nil
+	}
+
+	// Codes are namespaced under the tenant, if there is one
+	tenant := requestTenant(request)
+	if tenant != "" {
+		if err := validateCustomAlias(tenant); err != nil {
+			return errorResponse(400, "invalid tenant"), nil
+		}
+	}
+
+	// Report every problem with the body at once, before touching DynamoDB
+	if errs := validateCreateRequest(&createReq); len(errs) > 0 {
+		return errs.response(), nil
 	}
 
-	// Generate a new short URL()
-	shortURL := generateShortURL()
-	// Create a new URLMapping object
+	// Hand back an existing mapping for this long URL if the caller asked for it.
+	// A custom alias always gets its own item.
+	if createReq.ReuseExisting && createReq.CustomAlias == "" && !dryRun {
+		existing, err := findMappingByLongURL(ctx, createReq.LongURL, tenant)
+		if err != nil {
+			return errorResponse(500, "Error querying DynamoDB"), err
+		}
+		if existing != nil {
+			existing.ShortURLFull = fullShortURL(request, existing.ShortURL)
+			return jsonResponse(200, existing)
+		}
+	}
+
+	// Create a new URLMapping object; the short code is filled in below
 	urlMapping := URLMapping{
-		ShortURL:    shortURL,
-		LongURL:     createReq.LongURL,
-		CreatedAt:   time.Now(),
-		AccessCount: 0,
+		LongURL:         createReq.LongURL,
+		Destinations:    createReq.Destinations,
+		GeoDestinations: createReq.GeoDestinations,
+		IOSURL:          createReq.IOSURL,
+		AndroidURL:      createReq.AndroidURL,
+		RedirectHeaders: createReq.RedirectHeaders,
+		WebhookURL:      createReq.WebhookURL,
+		Interstitial:    createReq.Interstitial,
+		Fragment:        createReq.Fragment,
+		CreatedAt:       time.Now(),
+		AccessCount:     0,
+		Permanent:       createReq.Permanent,
+		RedirectCode:    createReq.RedirectCode,
+		Tenant:          tenant,
+		MaxClicks:       createReq.MaxClicks,
+		CreatedBy:       requestPrincipal(request),
+		UTMSource:       createReq.UTMSource,
+		UTMMedium:       createReq.UTMMedium,
+		UTMCampaign:     createReq.UTMCampaign,
+		RankKey:         newRankKey(),
+	}
+	if createReq.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(createReq.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return errorResponse(400, "Invalid password"), nil
+		}
+		urlMapping.PasswordHash = string(hash)
+	}
+	if createReq.ExpiresInSeconds > 0 {
+		urlMapping.ExpiresAt = urlMapping.CreatedAt.Unix() + createReq.ExpiresInSeconds
+	}
+
+	// Catch dead links up front; a dry run checks too since this is validation
+	if createReq.VerifyReachable {
+		status, err := checkReachable(ctx, urlMapping.LongURL)
+		if err != nil {
+			loggerFrom(ctx).Info("Destination unreachable", slog.Any("error", err))
+			return jsonResponse(422, UnreachableResponse{Error: "destination is not reachable"})
+		}
+		if status >= 300 && status < 400 {
+			// The check follows three redirects, so a 3xx here is a loop or a long chain
+			return jsonResponse(422, UnreachableResponse{Error: "destination redirects too many times", Status: status})
+		}
+		if status >= 400 {
+			return jsonResponse(422, UnreachableResponse{Error: "destination returned an error status", Status: status})
+		}
+	}
+
+	if createReq.FetchMetadata && !dryRun {
+		preview := fetchLinkPreview(ctx, urlMapping.LongURL)
+		urlMapping.PreviewTitle = preview.Title
+		urlMapping.PreviewImage = preview.Image
+	}
+
+	// Show the caller what would be stored without saving it
+	if dryRun {
+		code := canonicalCode(createReq.CustomAlias)
+		if code == "" {
+			code = previewCode(ctx, urlMapping.LongURL)
+		}
+		urlMapping.ShortURL = mappingKey(tenant, code)
+		urlMapping.ShortURLFull = fullShortURL(request, urlMapping.ShortURL)
+		return jsonResponse(200, urlMapping)
+	}
+
+	// The canonical key is claimed by the conditional put below, but a variant
+	// stored before case-insensitive codes were enabled would be shadowed by it
+	if createReq.CustomAlias != "" {
+		taken, err := caseVariantTaken(ctx, tenant, createReq.CustomAlias)
+		if err != nil {
+			return errorResponse(500, "Error querying DynamoDB"), err
+		}
+		if taken {
+			return errorResponse(409, "alias already in use"), nil
+		}
+	}
+
+	// Custom aliases count against the caller's reservation quota; random codes don't
+	created := false
+	if createReq.CustomAlias != "" && quotaTable != "" && maxAliasesPerKey > 0 {
+		quotaID := aliasQuotaID(urlMapping.CreatedBy)
+		used, err := takeQuota(ctx, quotaID, maxAliasesPerKey, 1)
+		if errors.Is(err, errQuotaExceeded) {
+			return jsonResponse(403, QuotaErrorResponse{Error: "custom alias limit reached", Used: used, Limit: maxAliasesPerKey})
+		}
+		if err != nil {
+			return errorResponse(500, "Error updating quota"), err
+		}
+		// Hand the reservation back if the alias turns out to be taken or the write fails
+		defer func() {
+			if !created {
+				releaseQuota(ctx, quotaID, 1)
+			}
+		}()
+	}
+
+	// Tenants with a quota can only have so many live links
+	if tenantQuotaEnabled(tenant) {
+		quotaID := tenantQuotaID(tenant)
+		used, err := takeQuota(ctx, quotaID, maxLinksPerTenant, 1)
+		if errors.Is(err, errQuotaExceeded) {
+			return jsonResponse(403, QuotaErrorResponse{Error: "tenant link limit reached", Used: used, Limit: maxLinksPerTenant})
+		}
+		if err != nil {
+			return errorResponse(500, "Error updating quota"), err
+		}
+		defer func() {
+			if !created {
+				releaseQuota(ctx, quotaID, 1)
+			}
+		}()
+	}
+
+	// Save item to DynamoDB, regenerating the code if it is already taken
+	_, hashCodes := codeGenerator.(hashGenerator)
+	for attempt := 1; ; attempt++ {
+		code := canonicalCode(createReq.CustomAlias)
+		switch {
+		case code != "":
+		case hashCodes:
+			// Each collision with another URL takes one more character of the hash
+			code = hashCode(urlMapping.LongURL, min(shortCodeLength+attempt-1, maxShortCodeLength))
+		default:
+			code, err = codeGenerator.Generate(ctx, urlMapping.LongURL)
+			if err != nil {
+				return errorResponse(500, "Error generating short code"), err
+			}
+		}
+		urlMapping.setKey(mappingKey(tenant, code))
+
+		// Convert the URLMapping to DynamoDB attribute values
+		item, err := attributevalue.MarshalMap(urlMapping)
+		if err != nil {
+			return errorResponse(500, "Error marshaling item"), err
+		}
+
+		_, err = ddbClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           &tableName,
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(short_url)"),
+		})
+		if err == nil {
+			break
+		}
+
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) && createReq.CustomAlias != "" {
+			// A custom alias can't be regenerated, so tell the caller it's taken
+			return errorResponse(409, "alias already in use"), nil
+		}
+		if errors.As(err, &condErr) && hashCodes {
+			// The same URL hashes to the same code, so this may be the link we
+			// would have created; hand it back rather than making another. A link
+			// that differs in anything but its code takes the next hash length.
+			existing, err := getMapping(ctx, urlMapping.ShortURL)
+			if err != nil {
+				return errorResponse(500, "Error querying DynamoDB"), err
+			}
+			if existing != nil && existing.LongURL == urlMapping.LongURL && existing.isLive(time.Now()) &&
+				sameLinkOptions(existing, &urlMapping, createReq.Password) {
+				existing.ShortURLFull = fullShortURL(request, existing.ShortURL)
+				return jsonResponse(200, existing)
+			}
+		}
+		if errors.As(err, &condErr) {
+			if attempt < maxCreateAttempts {
+				loggerFrom(ctx).Warn("Short code already taken, retrying", slog.String("short_code", urlMapping.ShortURL))
+				continue
+			}
+			// Every attempt collided; don't surface the raw conditional failure
+			loggerFrom(ctx).Error("Could not find a free short code", slog.Int("attempts", attempt))
+			return errorResponse(500, "Could not generate a unique short code"), nil
+		}
+
+		return errorResponse(500, "Error saving to DynamoDB"), err
+	}
+
+	created = true
+	loggerFrom(ctx).Info("Short URL created", slog.String("short_code", urlMapping.ShortURL))
+
+	if idempotencyKey != "" {
+		stored, err := saveIdempotentMapping(ctx, idempotencyKey, urlMapping)
+		if err != nil {
+			// The link exists either way; a later retry just won't be deduplicated
+			loggerFrom(ctx).Error("Error saving idempotency key", slog.Any("error", err))
+		} else if stored != nil {
+			urlMapping = *stored
+		}
+	}
+
+	//Return the created URLMapping as JSON
+	urlMapping.ShortURLFull = fullShortURL(request, urlMapping.ShortURL)
+	return createdResponse(urlMapping)
+}
+
+// createdResponse is the 201 for a new mapping, with Location pointing at its metadata
+func createdResponse(urlMapping URLMapping) (events.APIGatewayProxyResponse, error) {
+	response, err := jsonResponse(201, urlMapping)
+	if err != nil {
+		return response, err
+	}
+	response.Headers["Location"] = metadataPath(urlMapping.ShortURL)
+	return response, nil
+}
+
+// metadataPath is the path of a mapping's metadata. Tenant codes already
+// take two path segments, so theirs is the link itself with ?info=true.
+func metadataPath(shortURL string) string {
+	if strings.Contains(shortURL, "/") {
+		return "/" + shortURL + "?info=true"
 	}
+	return "/api/" + shortURL
+}
+
+// createRequestFromForm reads a create request from a form-encoded body.
+// Forms only carry the basics: long_url and an optional custom_alias.
+func createRequestFromForm(body string) (CreateURLRequest, error) {
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		return CreateURLRequest{}, err
+	}
+	return CreateURLRequest{
+		LongURL:     form.Get("long_url"),
+		CustomAlias: form.Get("custom_alias"),
+	}, nil
+}
+
+// redirectAttributes are the item attributes getOriginalURL reads.
+// Keep this in step with the URLMapping fields the redirect path uses.
+var redirectAttributes = []string{
+	"short_url", "long_url", "access_count", "expires_at", "deleted_at", "enabled",
+	"permanent", "redirect_code", "password_hash", "max_clicks",
+	"utm_source", "utm_medium", "utm_campaign",
+	"destinations", "geo_destinations", "ios_url", "android_url",
+	"redirect_headers", "webhook_url", "interstitial", "fragment",
+}
+
+// getOriginalURL handles GET requests to redirect short URLs
+func getOriginalURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Get the short URL from the path parameters
+	shortURL := requestShortURL(request)
 
-	// Convert the URLMapping to DynamoDB attribute values
-	item, err := attributevalue.MarshalMap(urlMapping)
+	urlMapping, err := getMapping(ctx, shortURL, redirectAttributes...)
 	if err != nil {
+		return errorResponse(500, "Error querying DynamoDB"), err
+	}
+
+	//Return 404 if URL not found, or send the visitor to the branded landing page.
+	//Expired and deleted links keep their own 410 below.
+	if urlMapping == nil {
+		if notFoundRedirect != "" {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 302,
+				Headers: map[string]string{
+					"Location":      notFoundRedirect,
+					"Cache-Control": redirectCacheControl(302),
+				},
+			}, nil
+		}
+		// People following a dead link get a page; API clients get JSON
+		if prefersJSON(headerValue(request, "Accept")) {
+			return errorResponse(404, "URL not found"), nil
+		}
 		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       "Error marshaling item",
-		}, err
+			StatusCode: 404,
+			Headers:    map[string]string{"Content-Type": "text/html; charset=utf-8"},
+			Body:       notFoundPage,
+		}, nil
+	}
+
+	//Refuse to redirect on a malformed or legacy item rather than send an empty Location
+	if err := checkStoredMapping(urlMapping); err != nil {
+		loggerFrom(ctx).Error("Stored mapping is malformed", slog.String("short_code", shortURL), slog.Any("error", err))
+		return errorResponse(500, "Stored URL is malformed"), nil
 	}
 
-	// Save item to DynamoDB
-	_, err = ddbClient.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: &tableName,
-		Item:      item,
+	//Return 410 for soft-deleted links, without counting the access
+	if urlMapping.DeletedAt != 0 {
+		return errorResponse(410, "URL has been deleted"), nil
+	}
+
+	//Return 410 if the link has expired but TTL hasn't removed it yet,
+	//or send it to the "link expired" page while it's in the grace window
+	if urlMapping.ExpiresAt != 0 && time.Now().Unix() >= urlMapping.ExpiresAt {
+		if expiredRedirect != "" && time.Now().Before(time.Unix(urlMapping.ExpiresAt, 0).Add(expiredGracePeriod)) {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 302,
+				Headers: map[string]string{
+					"Location":      expiredRedirect,
+					"Cache-Control": redirectCacheControl(302),
+				},
+			}, nil
+		}
+		return errorResponse(410, "URL has expired"), nil
+	}
+
+	//Paused links don't redirect or count the access
+	if !urlMapping.isEnabled() {
+		if disabledRedirect != "" {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 302,
+				Headers: map[string]string{
+					"Location":      disabledRedirect,
+					"Cache-Control": redirectCacheControl(302),
+				},
+			}, nil
+		}
+		return errorResponse(403, "URL is disabled"), nil
+	}
+
+	//Protected links only redirect when the right password is supplied
+	if err := requireLinkPassword(request, urlMapping); err != nil {
+		return errorResponse(401, err.Error()), nil
+	}
+
+	key, err := shortURLKey(shortURL)
+	if err != nil {
+		return errorResponse(500, "Error creating key"), err
+	}
+
+	// ADD is applied atomically by DynamoDB, so simultaneous redirects never
+	// lose an increment, and it treats a missing access_count as zero.
+	// last_accessed_at is set in the same write so the two always agree.
+	update := &dynamodb.UpdateItemInput{
+		TableName:        &tableName,
+		Key:              key,
+		UpdateExpression: aws.String("SET #la = :now ADD #ac :inc"),
+		// Alias access_count so the expression never collides with a reserved word
+		ExpressionAttributeNames: map[string]string{
+			"#ac": "access_count",
+			"#la": "last_accessed_at",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":inc": &types.AttributeValueMemberN{Value: "1"},
+			// Same RFC3339 string attributevalue writes for time.Time fields
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339Nano)},
+		},
+	}
+	if urlMapping.MaxClicks > 0 {
+		// Checking the cap in the same write means two simultaneous clicks
+		// can't both slip under it. The redirect has to wait for the answer.
+		update.ConditionExpression = aws.String("attribute_not_exists(#ac) OR #ac < max_clicks")
+		if _, err := ddbClient.UpdateItem(ctx, update); err != nil {
+			var condErr *types.ConditionalCheckFailedException
+			if errors.As(err, &condErr) {
+				return errorResponse(410, "URL has reached its click limit"), nil
+			}
+			// Without a successful count we can't tell whether the cap was hit
+			return errorResponse(500, "Error updating access count"), err
+		}
+	} else {
+		// Uncapped links count in the background and never block the redirect;
+		// a failed count is logged and lost
+		countAccess(ctx, update)
+	}
+
+	destination, split := destinationFor(urlMapping, request)
+
+	// Record the click for analytics without holding up the redirect
+	click := newClickEvent(shortURL, request, time.Now())
+	if split {
+		click.Variant = destination
+	}
+	recordClick(ctx, click)
+	notifyWebhook(ctx, urlMapping.WebhookURL, click)
+
+	loggerFrom(ctx).Info("Redirect served", slog.String("short_code", shortURL))
+	markRedirected(ctx)
+
+	// ?preview=true, or a link that asks for it, gets a page instead of a redirect
+	location := withFragment(withUTMParams(destination, urlMapping), urlMapping.Fragment)
+
+	// API clients can ask for the destination as data instead of following it.
+	// The access is counted above either way.
+	if prefersJSON(headerValue(request, "Accept")) {
+		response, err := jsonResponse(200, ResolvedURLResponse{LongURL: location})
+		response.Headers["Cache-Control"] = "no-cache"
+		response.Headers["Vary"] = "Accept"
+		return response, err
+	}
+	if urlMapping.Interstitial || request.QueryStringParameters["preview"] == "true" {
+		return interstitialResponse(location)
+	}
+
+	status := redirectStatus(urlMapping)
+
+	// Return a redirect response to the original URL
+	headers := customRedirectHeaders(urlMapping)
+	headers["Location"] = location // This header causes the browser to redirect
+	headers["Cache-Control"] = redirectCacheControl(status)
+	headers["Vary"] = "Accept" // JSON clients get a body instead, so caches must keep them apart
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    headers,
+	}, nil
+
+}
+
+// ResolvedURLResponse is the redirect's body for clients that asked for JSON
+type ResolvedURLResponse struct {
+	LongURL string `json:"long_url"`
+}
+
+// countAccess applies an access count update in the background, with its
+// own deadline because the request context ends with the response
+func countAccess(ctx context.Context, update *dynamodb.UpdateItemInput) {
+	goBackground(func() {
+		writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), clickWriteTimeout)
+		defer cancel()
+
+		if _, err := ddbClient.UpdateItem(writeCtx, update); err != nil {
+			loggerFrom(ctx).Error("Error updating access count", slog.Any("error", err))
+		}
 	})
+}
+
+// isEnabled reports whether the link may redirect; links are enabled unless paused
+func (m *URLMapping) isEnabled() bool {
+	return m.Enabled == nil || *m.Enabled
+}
+
+// isLive reports whether the link would still redirect: it isn't deleted,
+// expired, paused or out of clicks
+func (m *URLMapping) isLive(now time.Time) bool {
+	return m.DeletedAt == 0 && (m.ExpiresAt == 0 || now.Unix() < m.ExpiresAt) &&
+		m.isEnabled() && (m.MaxClicks == 0 || m.AccessCount < m.MaxClicks)
+}
+
+// sameLinkOptions reports whether existing is the link a create for want
+// would have made: same creator and same redirect options. A create with an
+// expiry always gets its own link, since expires_at is absolute.
+func sameLinkOptions(existing, want *URLMapping, password string) bool {
+	if existing.CreatedBy != want.CreatedBy || existing.ExpiresAt != 0 || want.ExpiresAt != 0 ||
+		existing.MaxClicks != want.MaxClicks || existing.WebhookURL != want.WebhookURL ||
+		existing.Permanent != want.Permanent || existing.RedirectCode != want.RedirectCode ||
+		existing.IOSURL != want.IOSURL || existing.AndroidURL != want.AndroidURL ||
+		existing.Interstitial != want.Interstitial || existing.Fragment != want.Fragment ||
+		existing.UTMSource != want.UTMSource || existing.UTMMedium != want.UTMMedium || existing.UTMCampaign != want.UTMCampaign {
+		return false
+	}
+	if !slices.Equal(existing.Destinations, want.Destinations) ||
+		!maps.Equal(existing.GeoDestinations, want.GeoDestinations) ||
+		!maps.Equal(existing.RedirectHeaders, want.RedirectHeaders) {
+		return false
+	}
+	if existing.PasswordHash == "" || password == "" {
+		return existing.PasswordHash == "" && password == ""
+	}
+	return bcrypt.CompareHashAndPassword([]byte(existing.PasswordHash), []byte(password)) == nil
+}
+
+// checkStoredMapping validates an item read back from DynamoDB before it is
+// used for a redirect. Older items may predate fields the code now expects.
+func checkStoredMapping(urlMapping *URLMapping) error {
+	if urlMapping.LongURL == "" {
+		return errors.New("item has no long_url")
+	}
+	parsed, err := url.Parse(urlMapping.LongURL)
+	if err != nil {
+		return fmt.Errorf("item long_url does not parse: %w", err)
+	}
+	if !parsed.IsAbs() {
+		return errors.New("item long_url is not absolute")
+	}
+	if urlMapping.AccessCount < 0 {
+		return errors.New("item access_count is negative")
+	}
+	return nil
+}
 
+// redirectStatus picks the redirect status code for a mapping
+// Browsers cache 301s aggressively, so only use one when the creator asked for it
+func redirectStatus(urlMapping *URLMapping) int {
+	if urlMapping.RedirectCode != 0 {
+		return urlMapping.RedirectCode
+	}
+	if urlMapping.Permanent {
+		return 301 //HTTP 301 Moved Permanently
+	}
+	return 302 //HTTP 302 Found
+}
+
+// redirectCacheControl is the Cache-Control header for a redirect status.
+// Without a max-age browsers keep 301s and 308s forever, so a link that is
+// later repointed or deleted would never be fetched again.
+func redirectCacheControl(status int) string {
+	switch status {
+	case 301, 308:
+		return fmt.Sprintf("public, max-age=%d", permanentRedirectMaxAge)
+	default:
+		return "no-cache"
+	}
+}
+
+// getURLInfo handles GET /api/{shortURL} requests
+// It returns the stored mapping as JSON without redirecting or counting an access
+func getURLInfo(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	shortURL := requestShortURL(request)
+
+	urlMapping, err := getMapping(ctx, shortURL)
 	if err != nil {
+		return errorResponse(500, "Error querying DynamoDB"), err
+	}
+	if urlMapping == nil {
+		return errorResponse(404, "URL not found"), nil
+	}
+	// Metadata names the destinations, so it is protected like the redirect
+	if err := requireLinkPassword(request, urlMapping); err != nil {
+		return errorResponse(401, err.Error()), nil
+	}
+
+	response, err := json.Marshal(urlMapping)
+	if err != nil {
+		return errorResponse(500, "Error encoding response"), err
+	}
+
+	// The body includes access_count, so hashing it changes the ETag on every
+	// click or edit; pollers with an unchanged copy get an empty 304
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(response))
+	if etagMatches(headerValue(request, "If-None-Match"), etag) {
 		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       "Error saving to DynamoDB",
-		}, err
+			StatusCode: 304,
+			Headers:    map[string]string{"ETag": etag},
+		}, nil
 	}
 
-	//Return the created URLMapping as JSON
-	response, _ := json.Marshal(urlMapping)
 	return events.APIGatewayProxyResponse{
-		StatusCode: 201,
+		StatusCode: 200,
 		Headers: map[string]string{
-			"Content-Type":                 "application/json",
-			"Access-Control-Allow-Origin":  "*",
-			"Access-Control-Allow-Methods": "GET,POST,OPTIONS",
-			"Access-Control-Allow-Headers": "Content-Type",
+			"Content-Type": "application/json",
+			"ETag":         etag,
 		},
 		Body: string(response),
 	}, nil
 }
 
-// getOriginalURL handles GET requests to redirect short URLs
-func getOriginalURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	// Get the short URL from the path parameters
-	shortURL := request.PathParameters["shortURL"]
+// etagMatches reports whether an If-None-Match header matches etag.
+// The header may list several tags, and weak tags compare by their value.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// getMapping fetches the mapping for shortURL from DynamoDB
+// It returns nil without an error when the code doesn't exist
+// With attributes, only those are read, which costs less on items that carry
+// large metadata.
+func getMapping(ctx context.Context, shortURL string, attributes ...string) (*URLMapping, error) {
+	// Codes that could never have been stored don't need a read to rule out
+	if !validMappingKey(shortURL) {
+		return nil, nil
+	}
 
-	//Create the dynamodb key for querying
-	key, err := attributevalue.MarshalMap(map[string]string{
+	key, err := shortURLKey(shortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	//Get item from DynamoDB
+	input := &dynamodb.GetItemInput{
+		TableName:      &tableName,
+		Key:            key,
+		ConsistentRead: aws.Bool(consistentReads),
+	}
+	if len(attributes) > 0 {
+		// Alias every name so none can collide with a reserved word
+		input.ExpressionAttributeNames = make(map[string]string, len(attributes))
+		placeholders := make([]string, len(attributes))
+		for i, attribute := range attributes {
+			placeholders[i] = fmt.Sprintf("#p%d", i)
+			input.ExpressionAttributeNames[placeholders[i]] = attribute
+		}
+		input.ProjectionExpression = aws.String(strings.Join(placeholders, ", "))
+	}
+	result, err := ddbClient.GetItem(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	//Convert DynamoDB item back to URLMapping struct
+	var urlMapping URLMapping
+	if err := attributevalue.UnmarshalMap(result.Item, &urlMapping); err != nil {
+		return nil, err
+	}
+	return &urlMapping, nil
+}
+
+// findMappingByLongURL looks up an unexpired mapping for longURL within tenant
+// using the long_url GSI. It returns nil without an error when there is none.
+func findMappingByLongURL(ctx context.Context, longURL, tenant string) (*URLMapping, error) {
+	result, err := ddbClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              &tableName,
+		IndexName:              &longURLIndex,
+		KeyConditionExpression: aws.String("long_url = :u"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":u": &types.AttributeValueMemberS{Value: longURL},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []URLMapping
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &mappings); err != nil {
+		return nil, err
+	}
+	// A paused or used-up link would hand the caller a code that doesn't redirect
+	now := time.Now()
+	for i := range mappings {
+		if mappings[i].Tenant == tenant && mappings[i].isLive(now) {
+			return &mappings[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// shortURLKey builds the DynamoDB primary key for a short code
+func shortURLKey(shortURL string) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMap(map[string]string{
 		"short_url": shortURL,
 	})
+}
+
+// PatchURLRequest represents the expected JSON structure for PATCH requests
+type PatchURLRequest struct {
+	Enabled *bool `json:"enabled"`
+}
 
+// patchShortURL handles PATCH /api/{shortURL} requests to pause or resume a link
+func patchShortURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	shortURL := requestShortURL(request)
+	if !validMappingKey(shortURL) {
+		return errorResponse(400, "invalid short url"), nil
+	}
+
+	var patchReq PatchURLRequest
+	if err := json.Unmarshal([]byte(request.Body), &patchReq); err != nil {
+		return errorResponse(400, "Invalid request body"), nil
+	}
+	if patchReq.Enabled == nil {
+		return errorResponse(400, "enabled is required"), nil
+	}
+
+	key, err := shortURLKey(shortURL)
 	if err != nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       "Error creating key",
-		}, err
+		return errorResponse(500, "Error creating key"), err
 	}
 
-	//Get item from DynamoDB
-	result, err := ddbClient.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: &tableName,
-		Key:       key,
+	// Deleted links have to be restored before they can be resumed
+	result, err := ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           &tableName,
+		Key:                 key,
+		UpdateExpression:    aws.String("SET enabled = :e"),
+		ConditionExpression: aws.String("attribute_exists(short_url) AND attribute_not_exists(deleted_at)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":e": &types.AttributeValueMemberBOOL{Value: *patchReq.Enabled},
+		},
+		ReturnValues: types.ReturnValueAllNew,
 	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return errorResponse(404, "URL not found"), nil
+		}
+		return errorResponse(500, "Error updating DynamoDB"), err
+	}
+
+	var urlMapping URLMapping
+	if err := attributevalue.UnmarshalMap(result.Attributes, &urlMapping); err != nil {
+		return errorResponse(500, "Error unmarshaling item"), err
+	}
+	return jsonResponse(200, urlMapping)
+}
 
+// UpdateURLRequest represents the expected JSON structure for PUT requests
+type UpdateURLRequest struct {
+	LongURL string `json:"long_url"`
+}
+
+// updateShortURL handles PUT /api/{shortURL} requests to change a link's destination
+// created_at and access_count are left as they are
+func updateShortURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	shortURL := requestShortURL(request)
+	if !validMappingKey(shortURL) {
+		return errorResponse(400, "invalid short url"), nil
+	}
+
+	var updateReq UpdateURLRequest
+	if err := json.Unmarshal([]byte(request.Body), &updateReq); err != nil {
+		return errorResponse(400, "Invalid request body"), nil
+	}
+	longURL, err := cleanLongURL(updateReq.LongURL)
 	if err != nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       "Error querying DynamoDB",
-		}, err
+		return longURLErrorResponse(err), nil
 	}
 
-	//Return 404 if URL not found
-	if result.Item == nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 404,
-			Body:       "URL not found",
-		}, nil
+	key, err := shortURLKey(shortURL)
+	if err != nil {
+		return errorResponse(500, "Error creating key"), err
+	}
+
+	// Only update items that exist so unknown codes can report 404
+	result, err := ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           &tableName,
+		Key:                 key,
+		UpdateExpression:    aws.String("SET long_url = :u"),
+		ConditionExpression: aws.String("attribute_exists(short_url)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":u": &types.AttributeValueMemberS{Value: longURL},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return errorResponse(404, "URL not found"), nil
+		}
+		return errorResponse(500, "Error updating DynamoDB"), err
 	}
 
-	//Convert DynamoDB item back to URLMapping struct
 	var urlMapping URLMapping
-	err = attributevalue.UnmarshalMap(result.Item, &urlMapping)
+	if err := attributevalue.UnmarshalMap(result.Attributes, &urlMapping); err != nil {
+		return errorResponse(500, "Error unmarshaling item"), err
+	}
+	return jsonResponse(200, urlMapping)
+}
+
+// healthCheck handles GET /health liveness probes
+// With ?deep=true it also checks that the DynamoDB table is reachable
+func healthCheck(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	status, body := 200, `{"status":"ok"}`
+
+	if request.QueryStringParameters["deep"] == "true" {
+		checkCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+
+		_, err := ddbClient.DescribeTable(checkCtx, &dynamodb.DescribeTableInput{
+			TableName: &tableName,
+		})
+		if err != nil {
+			loggerFrom(ctx).Error("Health check could not describe table", slog.String("table", tableName), slog.Any("error", err))
+			status, body = 503, `{"status":"degraded"}`
+		}
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       body,
+	}, nil
+}
+
+// deleteShortURL handles DELETE requests to soft-delete a short URL
+func deleteShortURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Get the short URL from the path parameters
+	shortURL := requestShortURL(request)
+	if !validMappingKey(shortURL) {
+		return errorResponse(400, "invalid short url"), nil
+	}
+
+	//Create the dynamodb key for the item to delete
+	key, err := shortURLKey(shortURL)
 	if err != nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       "Error unmarshaling item",
-		}, err
+		return errorResponse(500, "Error creating key"), err
 	}
 
-	// Increment the access count asynchronously
-	// Note: We don't wait for this to complete before redirecting
+	// Mark the link deleted rather than removing it so it can be restored.
+	// Unknown and already-deleted codes report 404.
 	_, err = ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-		TableName:        &tableName,
-		Key:              key,
-		UpdateExpression: aws.String("SET access_count = access_count + :inc"),
+		TableName:           &tableName,
+		Key:                 key,
+		UpdateExpression:    aws.String("SET deleted_at = :now"),
+		ConditionExpression: aws.String("attribute_exists(short_url) AND attribute_not_exists(deleted_at)"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":inc": &types.AttributeValueMemberN{Value: "1"},
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
 		},
 	})
-
 	if err != nil {
-		log.Printf("Error updating access count :%v", err)
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return errorResponse(404, "URL not found"), nil
+		}
+		return errorResponse(500, "Error deleting from DynamoDB"), err
+	}
+
+	// A deleted link no longer counts against its tenant's quota
+	if tenant := requestTenant(request); tenantQuotaEnabled(tenant) {
+		releaseQuota(ctx, tenantQuotaID(tenant), 1)
 	}
 
-	// Return a redirect response to the original URL
 	return events.APIGatewayProxyResponse{
-		StatusCode: 301, //HTTP 301 Moved Permanently
-		Headers: map[string]string{
-			"Location":                     urlMapping.LongURL,
-			"Access-Control-Allow-Origin":  "*",
-			"Access-Control-Allow-Methods": "GET,POST,OPTIONS",
-			"Access-Control-Allow-Headers": "Content-Type", // This header causes the browser to redirect
+		StatusCode: 204,
+	}, nil
+}
+
+// restoreShortURL handles POST /api/{shortURL}/restore requests
+// It clears a soft delete as long as the retention window hasn't passed
+func restoreShortURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	shortURL := requestShortURL(request)
+	if !validMappingKey(shortURL) {
+		return errorResponse(400, "invalid short url"), nil
+	}
+
+	key, err := shortURLKey(shortURL)
+	if err != nil {
+		return errorResponse(500, "Error creating key"), err
+	}
+
+	// Restoring makes the link live again, so it needs room in the tenant's quota
+	tenant := requestTenant(request)
+	if tenantQuotaEnabled(tenant) {
+		used, err := takeQuota(ctx, tenantQuotaID(tenant), maxLinksPerTenant, 1)
+		if errors.Is(err, errQuotaExceeded) {
+			return jsonResponse(403, QuotaErrorResponse{Error: "tenant link limit reached", Used: used, Limit: maxLinksPerTenant})
+		}
+		if err != nil {
+			return errorResponse(500, "Error updating quota"), err
+		}
+	}
+
+	cutoff := time.Now().Add(-softDeleteRetention).Unix()
+	result, err := ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           &tableName,
+		Key:                 key,
+		UpdateExpression:    aws.String("REMOVE deleted_at"),
+		ConditionExpression: aws.String("attribute_exists(deleted_at) AND deleted_at > :cutoff"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cutoff": &types.AttributeValueMemberN{Value: strconv.FormatInt(cutoff, 10)},
 		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil && tenantQuotaEnabled(tenant) {
+		releaseQuota(ctx, tenantQuotaID(tenant), 1)
+	}
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return errorResponse(404, "No deleted URL to restore"), nil
+		}
+		return errorResponse(500, "Error updating DynamoDB"), err
+	}
+
+	var urlMapping URLMapping
+	if err := attributevalue.UnmarshalMap(result.Attributes, &urlMapping); err != nil {
+		return errorResponse(500, "Error unmarshaling item"), err
+	}
+	return jsonResponse(200, urlMapping)
+}
+
+// requireAPIKey checks the x-api-key header against the configured API keys
+// When no keys are configured every request is rejected
+func requireAPIKey(request events.APIGatewayProxyRequest) error {
+	key := headerValue(request, "x-api-key")
+	if key == "" {
+		return errors.New("missing api key")
+	}
+	for _, valid := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(valid)) == 1 {
+			return nil
+		}
+	}
+	return errors.New("invalid api key")
+}
+
+// requireLinkPassword checks the x-link-password header, or ?password, against
+// a protected link's hash. Links without a password always pass.
+func requireLinkPassword(request events.APIGatewayProxyRequest, urlMapping *URLMapping) error {
+	if urlMapping.PasswordHash == "" {
+		return nil
+	}
+	password := headerValue(request, "x-link-password")
+	if password == "" {
+		password = request.QueryStringParameters["password"]
+	}
+	if password == "" {
+		return errors.New("Password required")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(urlMapping.PasswordHash), []byte(password)) != nil {
+		return errors.New("Invalid password")
+	}
+	return nil
+}
+
+// headerValue returns the named request header, ignoring case
+func headerValue(request events.APIGatewayProxyRequest, name string) string {
+	if v, ok := request.Headers[name]; ok {
+		return v
+	}
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// requestMediaType returns the request's Content-Type without parameters,
+// lowercased, or "" when the header is missing or unparseable
+func requestMediaType(request events.APIGatewayProxyRequest) string {
+	mediaType, _, err := mime.ParseMediaType(headerValue(request, "Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// requireJSONBody rejects requests that declare a body other than JSON.
+// A missing Content-Type is let through so curl one-liners keep working.
+func requireJSONBody(request events.APIGatewayProxyRequest) error {
+	if headerValue(request, "Content-Type") == "" || requestMediaType(request) == "application/json" {
+		return nil
+	}
+	return errors.New("Content-Type must be application/json")
+}
+
+// prefersJSON reports whether an Accept header ranks application/json above
+// text/html. Missing or wildcard headers, as browsers and curl send, don't.
+func prefersJSON(accept string) bool {
+	jsonQ, htmlQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
+
+// notFoundPage is the page browsers get for an unknown short code
+const notFoundPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Link not found</title>
+</head>
+<body>
+<h1>Link not found</h1>
+<p>This short link doesn't exist. Check it for typos, or ask whoever shared it for a new one.</p>
+</body>
+</html>
+`
+
+// withCORS adds the CORS headers browsers need to call the API
+func withCORS(response events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	if response.Headers == nil {
+		response.Headers = map[string]string{}
+	}
+	response.Headers["Access-Control-Allow-Origin"] = corsAllowedOrigin
+	response.Headers["Access-Control-Allow-Methods"] = strings.Join(supportedMethods, ",")
+	response.Headers["Access-Control-Allow-Headers"] = "Content-Type,Idempotency-Key,x-api-key,x-link-password,x-tenant"
+	return response
+}
+
+// requestBodySize is the size of the decoded request body in bytes
+// Base64 bodies are measured by what they decode to, not their encoded length
+func requestBodySize(request events.APIGatewayProxyRequest) int {
+	if request.IsBase64Encoded {
+		padding := len(request.Body) - len(strings.TrimRight(request.Body, "="))
+		return base64.StdEncoding.DecodedLen(len(request.Body)) - padding
+	}
+	return len(request.Body)
+}
+
+// pathSegments splits a request path into its non-empty segments
+func pathSegments(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+// jsonResponse builds a JSON response with v as the body
+func jsonResponse(status int, v interface{}) (events.APIGatewayProxyResponse, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(500, "Error encoding response"), err
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
 	}, nil
+}
+
+// fullShortURL builds the public link for a short code, e.g. https://short.example.com/xyz123
+// SHORT_URL_BASE may be given with or without a trailing slash
+func fullShortURL(request events.APIGatewayProxyRequest, shortURL string) string {
+	base := shortURLBase
+	if base == "" {
+		base = "https://" + headerValue(request, "Host")
+	}
+	return strings.TrimRight(base, "/") + "/" + shortURL
+}
 
+// errorResponse builds a JSON error response of the form {"error":"msg"}
+func errorResponse(status int, msg string) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(map[string]string{"error": msg})
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
 }
 
-//generateShortURL creates a new short URL
-// Uses a timestamp
+// cleanLongURL validates a destination URL and returns its normalized form
+func cleanLongURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+
+	// Reject anything that isn't a plain absolute http(s) URL
+	if err := validateLongURL(raw); err != nil {
+		return "", err
+	}
+
+	// Shortening our own links would create redirect loops
+	if isSelfDomain(raw) {
+		return "", errSelfReferential
+	}
+
+	// Known-bad destinations are refused outright
+	if isBlockedDomain(raw) {
+		return "", errBlockedDomain
+	}
 
-func generateShortURL() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())[:8]
+	// Store one canonical form so equivalent URLs compare equal
+	return normalizeURL(raw)
+}
+
+// longURLErrorResponse is the response for a cleanLongURL error
+func longURLErrorResponse(err error) events.APIGatewayProxyResponse {
+	if errors.Is(err, errBlockedDomain) {
+		return errorResponse(403, longURLErrorMessage(err))
+	}
+	return errorResponse(400, longURLErrorMessage(err))
+}
+
+// longURLErrorMessage is the client-facing message for a cleanLongURL error
+func longURLErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errSelfReferential):
+		return "url points at this shortener"
+	case errors.Is(err, errBlockedDomain):
+		return "domain is blocked"
+	case errors.Is(err, errURLTooLong):
+		return fmt.Sprintf("url must be at most %d bytes", maxLongURLLength)
+	case errors.Is(err, errPrivateHost):
+		return "url points at a private or loopback address"
+	default:
+		return "invalid url"
+	}
+}
+
+// isSelfDomain reports whether raw's host is the configured self domain
+func isSelfDomain(raw string) bool {
+	if selfDomain == "" {
+		return false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Hostname(), selfDomain)
+}
+
+// isBlockedDomain reports whether raw's host, or any parent domain of it, is blocklisted
+func isBlockedDomain(raw string) bool {
+	if len(blockedDomains) == 0 {
+		return false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	// Walk login.evil.com -> evil.com -> com
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	for host != "" {
+		if blockedDomains[host] {
+			return true
+		}
+		dot := strings.Index(host, ".")
+		if dot < 0 {
+			break
+		}
+		host = host[dot+1:]
+	}
+	return false
+}
+
+// hostOf extracts the host from a domain setting that may include a scheme or path,
+// e.g. "short.example.com", "short.example.com/" or "https://short.example.com/x"
+func hostOf(domain string) string {
+	domain = strings.TrimSpace(domain)
+	if domain == "" {
+		return ""
+	}
+	if !strings.Contains(domain, "://") {
+		domain = "https://" + domain
+	}
+	parsed, err := url.Parse(domain)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// validateLongURL checks that raw is an absolute URL with an allowed scheme,
+// and that web URLs have a host
+func validateLongURL(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return errors.New("url is empty")
+	}
+
+	// len counts bytes, which is what the DynamoDB item size limit cares about
+	if len(raw) > maxLongURLLength {
+		return errURLTooLong
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("url does not parse: %w", err)
+	}
+
+	// Only configured schemes are allowed; script-carrying ones never are
+	scheme := strings.ToLower(parsed.Scheme)
+	if !allowedSchemes[scheme] || forbiddenSchemes[scheme] {
+		return fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+
+	// Web links need a host; mailto:, tel: and app links just need something after the scheme
+	if scheme == "http" || scheme == "https" {
+		if parsed.Host == "" || parsed.Hostname() == "" {
+			return errors.New("url has no host")
+		}
+	} else if parsed.Opaque == "" && parsed.Host == "" && parsed.Path == "" {
+		return errors.New("url has nothing after the scheme")
+	}
+
+	// Links to internal addresses such as 169.254.169.254 invite SSRF from
+	// anything that follows them server-side, like link previews
+	if !allowPrivateHosts && isPrivateHost(parsed.Hostname()) {
+		return errPrivateHost
+	}
+
+	return nil
+}
+
+// isPrivateHost reports whether host is localhost or an IP literal in a
+// loopback, private (RFC 1918, RFC 4193), link-local or unspecified range
+func isPrivateHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && isPrivateIP(ip)
+}
+
+// isPrivateIP reports whether ip is in a loopback, private, link-local or unspecified range
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// validateCustomAlias checks a user-chosen short code against the allowed format
+// and the list of reserved words
+func validateCustomAlias(alias string) error {
+	if !shortCodePattern.MatchString(alias) {
+		return errors.New("alias must be 3-32 letters, digits, '_' or '-'")
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	// A leading /vN segment selects an API version, so a tenant or alias
+	// named like one could never be reached under it
+	if versionPattern.MatchString(strings.ToLower(alias)) {
+		return fmt.Errorf("alias %q is reserved for API versions", alias)
+	}
+	return nil
+}
+
+// normalizeURL returns a canonical form of raw: lowercase scheme and host,
+// no default port, no lone trailing slash and sorted query parameters.
+// The path is left untouched because it is case-sensitive.
+func normalizeURL(raw string) (string, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	port := parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 literal
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	parsed.Host = host
+
+	if parsed.Path == "/" {
+		parsed.Path = ""
+		parsed.RawPath = ""
+	}
+
+	// Sort the raw pairs by key rather than re-encoding them, which would turn
+	// ?flag into ?flag= and rewrite escapes the destination may care about.
+	// The sort is stable, so repeated keys keep their order.
+	if parsed.RawQuery != "" {
+		pairs := strings.Split(parsed.RawQuery, "&")
+		slices.SortStableFunc(pairs, func(a, b string) int {
+			keyA, _, _ := strings.Cut(a, "=")
+			keyB, _, _ := strings.Cut(b, "=")
+			return strings.Compare(keyA, keyB)
+		})
+		parsed.RawQuery = strings.Join(pairs, "&")
+	}
+
+	return parsed.String(), nil
+}
+
+// shortCodeAlphabet is the set of characters generated codes are drawn from
+func shortCodeAlphabet() string {
+	return shortCodeCharset
+}
+
+// inShortCodeAlphabet reports whether every character of code is in shortCodeAlphabet
+func inShortCodeAlphabet(code string) bool {
+	for _, c := range code {
+		if !strings.ContainsRune(shortCodeAlphabet(), c) {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalCode returns the form a short code is stored and looked up under.
+// In case-insensitive mode that is lowercase, so AbC123 and abc123 match.
+func canonicalCode(code string) string {
+	if caseInsensitiveCodes {
+		return strings.ToLower(code)
+	}
+	return code
+}
+
+// setKey stores the mapping under key, keeping AliasKey in step with it
+func (m *URLMapping) setKey(key string) {
+	m.ShortURL = key
+	m.AliasKey = strings.ToLower(key)
+}
+
+// caseVariantTaken reports whether alias, in any casing, is already a code.
+// It checks in both case modes, so turning CASE_INSENSITIVE_CODES on later
+// can't make two existing links collide. Links saved before alias_key was
+// stored aren't in the index; in case-insensitive mode the alias's own
+// casing is also read directly, since that is the variant it would shadow.
+func caseVariantTaken(ctx context.Context, tenant, alias string) (bool, error) {
+	result, err := ddbClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              &tableName,
+		IndexName:              &aliasKeyIndex,
+		KeyConditionExpression: aws.String("alias_key = :k"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":k": &types.AttributeValueMemberS{Value: strings.ToLower(mappingKey(tenant, alias))},
+		},
+		ProjectionExpression: aws.String("short_url"),
+		Limit:                aws.Int32(1),
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(result.Items) > 0 {
+		return true, nil
+	}
+
+	if !caseInsensitiveCodes || canonicalCode(alias) == alias {
+		return false, nil
+	}
+	key, err := shortURLKey(mappingKey(tenant, alias))
+	if err != nil {
+		return false, err
+	}
+	legacy, err := ddbClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            &tableName,
+		Key:                  key,
+		ProjectionExpression: aws.String("short_url"),
+	})
+	if err != nil {
+		return false, err
+	}
+	return legacy.Item != nil, nil
+}
+
+// generateShortCode creates a random code of length n from shortCodeAlphabet
+// Uses crypto/rand so codes can't be predicted or collide by timing
+func generateShortCode(n int) string {
+	alphabet := shortCodeAlphabet()
+	code := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(code) < n {
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("crypto/rand failed: %v", err))
+		}
+		for _, b := range buf {
+			// Skip bytes past the largest multiple of the alphabet size to avoid modulo bias
+			if int(b) >= 256-(256%len(alphabet)) {
+				continue
+			}
+			code = append(code, alphabet[int(b)%len(alphabet)])
+			if len(code) == n {
+				break
+			}
+		}
+	}
+	return string(code)
 }
 
 // main function starts the lambda
+// Set API_PAYLOAD_VERSION=2.0 when the function sits behind an HTTP API
 func main() {
-	lambda.Start(handleRequest)
+	// First deploys can have the function create its own table at cold start
+	if ensureTableEnabled {
+		provisionTable()
+	}
+
+	if os.Getenv("API_PAYLOAD_VERSION") == "2.0" {
+		lambda.Start(withWarmup(handleHTTPAPIRequest))
+		return
+	}
+	lambda.Start(withWarmup(handleRequest))
 }
@@ -0,0 +1,1731 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// testAPIKey is the only key the tests configure in API_KEYS
+const testAPIKey = "test-key"
+
+func TestMain(m *testing.M) {
+	tableName = "urls"
+	apiKeys = []string{testAPIKey}
+	shortURLBase = "https://sho.rt"
+	metricsOutput = io.Discard
+	baseLogger = newJSONLogger(io.Discard)
+	os.Exit(m.Run())
+}
+
+// setVar sets a package variable for the rest of the test
+func setVar[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// newRequest builds an API Gateway request the way the REST API's
+// /{shortURL} and /api/{shortURL}/... resources would deliver it
+func newRequest(method, path, body string) events.APIGatewayProxyRequest {
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod: method,
+		Path:       path,
+		Body:       body,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+			"Host":         "sho.rt",
+		},
+		QueryStringParameters: map[string]string{},
+		PathParameters:        map[string]string{},
+	}
+	if method != "GET" {
+		request.Headers["x-api-key"] = testAPIKey
+	}
+	if i := strings.Index(path, "?"); i >= 0 {
+		request.Path = path[:i]
+		for _, pair := range strings.Split(path[i+1:], "&") {
+			k, v, _ := strings.Cut(pair, "=")
+			request.QueryStringParameters[k] = v
+		}
+	}
+
+	segments := pathSegments(request.Path)
+	if len(segments) > 0 && versionPattern.MatchString(segments[0]) && len(segments) > 1 {
+		segments = segments[1:]
+	}
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		request.PathParameters["shortURL"] = segments[1]
+	case len(segments) == 1:
+		request.PathParameters["shortURL"] = segments[0]
+	}
+	request.RequestContext.RequestID = "req-1"
+	request.RequestContext.Identity.SourceIP = "203.0.113.7"
+	return request
+}
+
+// serve runs a request through the full handler
+func serve(t *testing.T, request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	t.Helper()
+	response, err := handleRequest(context.Background(), request)
+	if err != nil {
+		t.Fatalf("%s %s: handler error: %v", request.HTTPMethod, request.Path, err)
+	}
+	return response
+}
+
+// decode unmarshals a response body into v
+func decode(t *testing.T, response events.APIGatewayProxyResponse, v any) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(response.Body), v); err != nil {
+		t.Fatalf("decode body %q: %v", response.Body, err)
+	}
+}
+
+// createLink creates a link through the API and returns the stored mapping
+func createLink(t *testing.T, body string) URLMapping {
+	t.Helper()
+	response := serve(t, newRequest("POST", "/", body))
+	if response.StatusCode != 201 {
+		t.Fatalf("create %s: status %d, body %s", body, response.StatusCode, response.Body)
+	}
+	var m URLMapping
+	decode(t, response, &m)
+	return m
+}
+
+// seedLink stores a mapping directly, bypassing the create handler
+func seedLink(t *testing.T, db *fakeDB, m URLMapping) {
+	t.Helper()
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	db.seed(t, "urls", m)
+}
+
+func TestRedirectCountsEachAccess(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+
+	for i := 0; i < 2; i++ {
+		if response := serve(t, newRequest("GET", "/abc1234", "")); response.StatusCode != 302 {
+			t.Fatalf("redirect %d: status %d", i+1, response.StatusCode)
+		}
+	}
+
+	if got := db.mapping(t, "abc1234").AccessCount; got != 2 {
+		t.Fatalf("access_count = %d, want 2", got)
+	}
+}
+
+func TestCreateValidatesLongURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		longURL string
+		status  int
+	}{
+		{"empty", "", 400},
+		{"ftp", "ftp://example.com/file", 400},
+		{"javascript", "javascript:alert(1)", 400},
+		{"valid https", "https://example.com", 201},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t)
+			body, _ := json.Marshal(map[string]string{"long_url": tt.longURL})
+			response := serve(t, newRequest("POST", "/", string(body)))
+			if response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", response.StatusCode, tt.status, response.Body)
+			}
+			if stored := len(db.items("urls")); (tt.status == 201) != (stored == 1) {
+				t.Fatalf("stored %d items for a %d response", stored, tt.status)
+			}
+		})
+	}
+}
+
+func TestGeneratedCodesAreSevenAlphanumerics(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9A-Za-z]{7}$`)
+	for i := 0; i < 200; i++ {
+		if code := generateShortCode(shortCodeLength); !pattern.MatchString(code) {
+			t.Fatalf("generated code %q doesn't match %s", code, pattern)
+		}
+	}
+}
+
+// sequenceGenerator hands out fixed codes in order
+type sequenceGenerator struct {
+	mu    sync.Mutex
+	codes []string
+}
+
+func (g *sequenceGenerator) Generate(ctx context.Context, longURL string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	code := g.codes[0]
+	g.codes = g.codes[1:]
+	return code, nil
+}
+
+func TestCreateRetriesWhenGeneratedCodeIsTaken(t *testing.T) {
+	db := useFakeDB(t)
+	setVar[CodeGenerator](t, &codeGenerator, &sequenceGenerator{codes: []string{"TAKEN01", "FRESH01"}})
+	seedLink(t, db, URLMapping{ShortURL: "TAKEN01", LongURL: "https://other.example.com"})
+
+	created := createLink(t, `{"long_url":"https://example.com"}`)
+	if created.ShortURL != "FRESH01" {
+		t.Fatalf("short_url = %q, want the second code FRESH01", created.ShortURL)
+	}
+	if got := db.mapping(t, "TAKEN01").LongURL; got != "https://other.example.com" {
+		t.Fatalf("existing link was overwritten with %q", got)
+	}
+	if got := db.called("PutItem"); got != 2 {
+		t.Fatalf("PutItem called %d times, want 2", got)
+	}
+}
+
+func TestCreateWithCustomAlias(t *testing.T) {
+	t.Run("free alias", func(t *testing.T) {
+		useFakeDB(t)
+		created := createLink(t, `{"long_url":"https://example.com","custom_alias":"my-link"}`)
+		if created.ShortURL != "my-link" {
+			t.Fatalf("short_url = %q, want my-link", created.ShortURL)
+		}
+	})
+	t.Run("taken alias", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "my-link", LongURL: "https://other.example.com"})
+		response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"my-link"}`))
+		if response.StatusCode != 409 {
+			t.Fatalf("status = %d, want 409", response.StatusCode)
+		}
+	})
+	t.Run("illegal characters", func(t *testing.T) {
+		db := useFakeDB(t)
+		response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"my link!"}`))
+		if response.StatusCode != 400 {
+			t.Fatalf("status = %d, want 400", response.StatusCode)
+		}
+		if db.called("PutItem") != 0 {
+			t.Fatal("an invalid alias was written")
+		}
+	})
+}
+
+func TestDeleteShortURL(t *testing.T) {
+	t.Run("existing code", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+		if response := serve(t, newRequest("DELETE", "/abc1234", "")); response.StatusCode != 204 {
+			t.Fatalf("status = %d, want 204", response.StatusCode)
+		}
+		if response := serve(t, newRequest("GET", "/abc1234", "")); response.StatusCode == 302 {
+			t.Fatal("deleted link still redirects")
+		}
+	})
+	t.Run("nonexistent code", func(t *testing.T) {
+		useFakeDB(t)
+		if response := serve(t, newRequest("DELETE", "/nope123", "")); response.StatusCode != 404 {
+			t.Fatalf("status = %d, want 404", response.StatusCode)
+		}
+	})
+	t.Run("empty path parameter", func(t *testing.T) {
+		db := useFakeDB(t)
+		if response := serve(t, newRequest("DELETE", "/", "")); response.StatusCode != 400 {
+			t.Fatalf("status = %d, want 400", response.StatusCode)
+		}
+		if db.called("UpdateItem")+db.called("DeleteItem") != 0 {
+			t.Fatal("an empty code reached DynamoDB")
+		}
+	})
+}
+
+func TestRedirectHonorsExpiry(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name      string
+		expiresAt int64
+		status    int
+	}{
+		{"unexpired", now + 3600, 302},
+		{"expired", now - 60, 410},
+		{"no expiry", 0, 302},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t)
+			setVar(t, &expiredRedirect, "")
+			seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com", ExpiresAt: tt.expiresAt})
+			if response := serve(t, newRequest("GET", "/abc1234", "")); response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestCreateStoresExpiry(t *testing.T) {
+	db := useFakeDB(t)
+	created := createLink(t, `{"long_url":"https://example.com","expires_in_seconds":60}`)
+	stored := db.mapping(t, created.ShortURL)
+	if want := stored.CreatedAt.Unix() + 60; stored.ExpiresAt != want {
+		t.Fatalf("expires_at = %d, want %d", stored.ExpiresAt, want)
+	}
+}
+
+func TestErrorResponsesAreJSON(t *testing.T) {
+	useFakeDB(t)
+	requests := map[string]events.APIGatewayProxyRequest{
+		"bad body":  newRequest("POST", "/", "not json"),
+		"not found": newRequest("GET", "/api/missing", ""),
+		"no key":    newRequest("DELETE", "/api/missing", ""),
+	}
+	delete(requests["no key"].Headers, "x-api-key")
+
+	for name, request := range requests {
+		t.Run(name, func(t *testing.T) {
+			response := serve(t, request)
+			if response.StatusCode < 400 {
+				t.Fatalf("status = %d, want an error", response.StatusCode)
+			}
+			if ct := response.Headers["Content-Type"]; ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var body map[string]any
+			decode(t, response, &body)
+			if msg, _ := body["error"].(string); msg == "" {
+				t.Fatalf("body %s has no error message", response.Body)
+			}
+		})
+	}
+}
+
+func TestRedirectStatusFollowsPermanent(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"long_url":"https://example.com","permanent":false}`, 302},
+		{`{"long_url":"https://example.com","permanent":true}`, 301},
+		{`{"long_url":"https://example.com"}`, 302},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			useFakeDB(t)
+			created := createLink(t, tt.body)
+			if response := serve(t, newRequest("GET", "/"+created.ShortURL, "")); response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestMetadataRouteDoesNotRedirectOrCount(t *testing.T) {
+	for _, path := range []string{"/api/abc1234", "/abc1234?info=true"} {
+		t.Run(path, func(t *testing.T) {
+			db := useFakeDB(t)
+			seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com", AccessCount: 3})
+
+			response := serve(t, newRequest("GET", path, ""))
+			if response.StatusCode != 200 || response.Headers["Location"] != "" {
+				t.Fatalf("response = %d with Location %q, want 200 and no redirect", response.StatusCode, response.Headers["Location"])
+			}
+			var got URLMapping
+			decode(t, response, &got)
+			if got.LongURL != "https://example.com" || got.AccessCount != 3 {
+				t.Fatalf("metadata = %+v", got)
+			}
+			if stored := db.mapping(t, "abc1234"); stored.AccessCount != 3 {
+				t.Fatalf("access_count = %d after a metadata read, want 3", stored.AccessCount)
+			}
+		})
+	}
+}
+
+func TestCreateReusesExistingCode(t *testing.T) {
+	db := useFakeDB(t)
+	first := createLink(t, `{"long_url":"https://example.com/a"}`)
+
+	t.Run("hit", func(t *testing.T) {
+		response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com/a","reuse_existing":true}`))
+		var got URLMapping
+		decode(t, response, &got)
+		if response.StatusCode != 200 || got.ShortURL != first.ShortURL {
+			t.Fatalf("reuse = %d %q, want 200 %q", response.StatusCode, got.ShortURL, first.ShortURL)
+		}
+	})
+	t.Run("miss", func(t *testing.T) {
+		got := createLink(t, `{"long_url":"https://example.com/b","reuse_existing":true}`)
+		if got.ShortURL == first.ShortURL {
+			t.Fatalf("a different URL reused %q", first.ShortURL)
+		}
+	})
+	t.Run("not asked", func(t *testing.T) {
+		got := createLink(t, `{"long_url":"https://example.com/a"}`)
+		if got.ShortURL == first.ShortURL {
+			t.Fatalf("create without reuse_existing reused %q", first.ShortURL)
+		}
+	})
+	if n := len(db.items("urls")); n != 3 {
+		t.Fatalf("%d items stored, want 3", n)
+	}
+}
+
+func TestWritesRequireAPIKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		status int
+	}{
+		{"valid", testAPIKey, 201},
+		{"missing", "", 401},
+		{"wrong", "nope", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t)
+			request := newRequest("POST", "/", `{"long_url":"https://example.com"}`)
+			request.Headers["x-api-key"] = tt.key
+			if response := serve(t, request); response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+			if tt.status == 401 && db.called("PutItem") != 0 {
+				t.Fatal("an unauthenticated create reached DynamoDB")
+			}
+		})
+	}
+
+	t.Run("redirects stay public", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+		if response := serve(t, newRequest("GET", "/abc1234", "")); response.StatusCode != 302 {
+			t.Fatalf("status = %d, want 302 without a key", response.StatusCode)
+		}
+	})
+}
+
+func TestPreflightReturnsCORSHeaders(t *testing.T) {
+	db := useFakeDB(t)
+	setVar(t, &corsAllowedOrigin, "https://app.example.com")
+
+	response := serve(t, newRequest("OPTIONS", "/", ""))
+	if response.StatusCode != 204 {
+		t.Fatalf("status = %d, want 204", response.StatusCode)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+	}
+	for name, value := range want {
+		if got := response.Headers[name]; got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if !strings.Contains(response.Headers["Access-Control-Allow-Headers"], "x-api-key") {
+		t.Errorf("Access-Control-Allow-Headers = %q, want x-api-key listed", response.Headers["Access-Control-Allow-Headers"])
+	}
+	if db.totalCalls() != 0 {
+		t.Fatal("preflight touched DynamoDB")
+	}
+
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+	if got := serve(t, newRequest("GET", "/abc1234", "")).Headers["Access-Control-Allow-Origin"]; got != "https://app.example.com" {
+		t.Fatalf("redirect Access-Control-Allow-Origin = %q", got)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Run("healthy", func(t *testing.T) {
+		db := useFakeDB(t)
+		response := serve(t, newRequest("GET", "/health?deep=true", ""))
+		if response.StatusCode != 200 || response.Body != `{"status":"ok"}` {
+			t.Fatalf("health = %d %s", response.StatusCode, response.Body)
+		}
+		if db.called("DescribeTable") != 1 {
+			t.Fatal("deep health check did not describe the table")
+		}
+	})
+	t.Run("dynamodb down", func(t *testing.T) {
+		db := useFakeDB(t)
+		db.before = func(ctx context.Context, op string, input any) error {
+			return errors.New("connection refused")
+		}
+		response := serve(t, newRequest("GET", "/health?deep=true", ""))
+		if response.StatusCode != 503 || response.Body != `{"status":"degraded"}` {
+			t.Fatalf("health = %d %s", response.StatusCode, response.Body)
+		}
+	})
+	t.Run("shallow", func(t *testing.T) {
+		db := useFakeDB(t)
+		if response := serve(t, newRequest("GET", "/health", "")); response.StatusCode != 200 || db.totalCalls() != 0 {
+			t.Fatalf("shallow health = %d after %d DynamoDB calls", response.StatusCode, db.totalCalls())
+		}
+	})
+}
+
+func TestCreateRejectsMissingLongURL(t *testing.T) {
+	for _, body := range []string{`{"long_url":""}`, `{"long_url":"   "}`, `{}`} {
+		t.Run(body, func(t *testing.T) {
+			db := useFakeDB(t)
+			if response := serve(t, newRequest("POST", "/", body)); response.StatusCode != 400 {
+				t.Fatalf("status = %d, want 400", response.StatusCode)
+			}
+			if db.called("PutItem") != 0 {
+				t.Fatal("a create without long_url wrote to DynamoDB")
+			}
+		})
+	}
+}
+
+// withAPIKey adds the test key to a request that would not otherwise send one
+func withAPIKey(request events.APIGatewayProxyRequest) events.APIGatewayProxyRequest {
+	request.Headers["x-api-key"] = testAPIKey
+	return request
+}
+
+func TestReservedRouteNamesCannotBeAliases(t *testing.T) {
+	for _, alias := range []string{"urls", "export", "lookup", "available", "stats", "health"} {
+		t.Run(alias, func(t *testing.T) {
+			useFakeDB(t)
+			response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"`+alias+`"}`))
+			if response.StatusCode != 400 {
+				t.Fatalf("status = %d, want 400", response.StatusCode)
+			}
+		})
+	}
+}
+
+func TestPasswordProtectedLinks(t *testing.T) {
+	db := useFakeDB(t)
+	created := createLink(t, `{"long_url":"https://example.com/secret","password":"hunter2"}`)
+	if stored := db.mapping(t, created.ShortURL); stored.PasswordHash == "" || strings.Contains(stored.PasswordHash, "hunter2") {
+		t.Fatalf("stored password hash = %q", stored.PasswordHash)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		status   int
+	}{
+		{"correct", "hunter2", 302},
+		{"wrong", "letmein", 401},
+		{"missing", "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range []string{"/" + created.ShortURL, "/api/" + created.ShortURL} {
+				request := newRequest("GET", path, "")
+				if tt.password != "" {
+					request.Headers["x-link-password"] = tt.password
+				}
+				want := tt.status
+				if want == 302 && strings.HasPrefix(path, "/api/") {
+					want = 200
+				}
+				if response := serve(t, request); response.StatusCode != want {
+					t.Fatalf("GET %s = %d, want %d", path, response.StatusCode, want)
+				}
+			}
+		})
+	}
+
+	t.Run("query parameter", func(t *testing.T) {
+		if response := serve(t, newRequest("GET", "/"+created.ShortURL+"?password=hunter2", "")); response.StatusCode != 302 {
+			t.Fatalf("status = %d, want 302", response.StatusCode)
+		}
+	})
+	t.Run("unprotected", func(t *testing.T) {
+		plain := createLink(t, `{"long_url":"https://example.com/open"}`)
+		if response := serve(t, newRequest("GET", "/"+plain.ShortURL, "")); response.StatusCode != 302 {
+			t.Fatalf("status = %d, want 302", response.StatusCode)
+		}
+	})
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"HTTPS://Example.COM/", "https://example.com"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"http://example.com:80", "http://example.com"},
+		{"http://example.com:8080/", "http://example.com:8080"},
+		{"https://example.com/Path/Case", "https://example.com/Path/Case"},
+		{"https://example.com/s?b=2&a=1", "https://example.com/s?a=1&b=2"},
+		{"https://example.com/s?flag&a=1", "https://example.com/s?a=1&flag"},
+		{"https://example.com/s?q=a+b%2Fc&e=%7e", "https://example.com/s?e=%7e&q=a+b%2Fc"},
+		{"https://example.com/s?tag=y&id=1&tag=x", "https://example.com/s?id=1&tag=y&tag=x"},
+		{"https://[::1]:443/", "https://[::1]"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeURL(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestCreateStoresNormalizedURL(t *testing.T) {
+	db := useFakeDB(t)
+	created := createLink(t, `{"long_url":"HTTPS://Example.com:443/?z=1&a=2"}`)
+	if got := db.mapping(t, created.ShortURL).LongURL; got != "https://example.com?a=2&z=1" {
+		t.Fatalf("stored long_url = %q", got)
+	}
+}
+
+func TestUpdateShortURL(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("success", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://old.example", CreatedAt: created, AccessCount: 7})
+
+		response := serve(t, newRequest("PUT", "/api/abc1234", `{"long_url":"https://new.example/page"}`))
+		if response.StatusCode != 200 {
+			t.Fatalf("status = %d, body %s", response.StatusCode, response.Body)
+		}
+		stored := db.mapping(t, "abc1234")
+		if stored.LongURL != "https://new.example/page" || stored.AccessCount != 7 || !stored.CreatedAt.Equal(created) {
+			t.Fatalf("stored = %+v", stored)
+		}
+	})
+	t.Run("unknown code", func(t *testing.T) {
+		db := useFakeDB(t)
+		if response := serve(t, newRequest("PUT", "/api/missing1", `{"long_url":"https://new.example"}`)); response.StatusCode != 404 {
+			t.Fatalf("status = %d, want 404", response.StatusCode)
+		}
+		if db.mapping(t, "missing1") != nil {
+			t.Fatal("update created an item for an unknown code")
+		}
+	})
+	t.Run("invalid url", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://old.example"})
+		if response := serve(t, newRequest("PUT", "/api/abc1234", `{"long_url":"javascript:alert(1)"}`)); response.StatusCode != 400 {
+			t.Fatalf("status = %d, want 400", response.StatusCode)
+		}
+		if got := db.mapping(t, "abc1234").LongURL; got != "https://old.example" {
+			t.Fatalf("long_url = %q after a rejected update", got)
+		}
+	})
+}
+
+func TestCreateRejectsSelfReferentialURL(t *testing.T) {
+	setVar(t, &selfDomain, hostOf("sho.rt"))
+	tests := []struct {
+		longURL string
+		status  int
+	}{
+		{"https://sho.rt/abc1234", 400},
+		{"https://SHO.RT", 400},
+		{"https://sho.rt/", 400},
+		{"https://example.com/sho.rt", 201},
+	}
+	for _, tt := range tests {
+		t.Run(tt.longURL, func(t *testing.T) {
+			useFakeDB(t)
+			if response := serve(t, newRequest("POST", "/", `{"long_url":"`+tt.longURL+`"}`)); response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestRedirectCodeIsHonored(t *testing.T) {
+	for _, code := range []int{301, 302, 307, 308} {
+		t.Run(strconv.Itoa(code), func(t *testing.T) {
+			useFakeDB(t)
+			created := createLink(t, fmt.Sprintf(`{"long_url":"https://example.com","redirect_code":%d}`, code))
+			if response := serve(t, newRequest("GET", "/"+created.ShortURL, "")); response.StatusCode != code {
+				t.Fatalf("status = %d, want %d", response.StatusCode, code)
+			}
+		})
+	}
+	t.Run("unsupported", func(t *testing.T) {
+		db := useFakeDB(t)
+		if response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","redirect_code":200}`)); response.StatusCode != 400 {
+			t.Fatalf("status = %d, want 400", response.StatusCode)
+		}
+		if db.called("PutItem") != 0 {
+			t.Fatal("an unsupported redirect_code was stored")
+		}
+	})
+}
+
+func TestCreateRejectsBlockedDomains(t *testing.T) {
+	setVar(t, &blockedDomains, domainSet("evil.com"))
+	tests := []struct {
+		longURL string
+		status  int
+	}{
+		{"https://evil.com/login", 403},
+		{"https://login.EVIL.com", 403},
+		{"https://notevil.com", 201},
+		{"https://example.com", 201},
+	}
+	for _, tt := range tests {
+		t.Run(tt.longURL, func(t *testing.T) {
+			useFakeDB(t)
+			response := serve(t, newRequest("POST", "/", `{"long_url":"`+tt.longURL+`"}`))
+			if response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestDryRunNeverTouchesDynamoDB(t *testing.T) {
+	db := useFakeDB(t)
+	setVar(t, &rateLimitTable, "ratelimit")
+	setVar(t, &idempotencyTable, "idempotency")
+
+	request := newRequest("POST", "/?dry_run=true", `{"long_url":"https://example.com","reuse_existing":true}`)
+	request.Headers["Idempotency-Key"] = "key-1"
+	response := serve(t, request)
+	var got URLMapping
+	decode(t, response, &got)
+	if response.StatusCode != 200 || got.ShortURL == "" || got.LongURL != "https://example.com" {
+		t.Fatalf("dry run = %d %+v", response.StatusCode, got)
+	}
+	if n := db.totalCalls(); n != 0 {
+		t.Fatalf("dry run made %d DynamoDB calls", n)
+	}
+
+	if response := serve(t, newRequest("POST", "/?dry_run=true", `{"long_url":"ftp://example.com"}`)); response.StatusCode != 400 {
+		t.Fatalf("invalid dry run = %d, want 400", response.StatusCode)
+	}
+}
+
+func TestMalformedCodesSkipTheLookup(t *testing.T) {
+	for _, code := range []string{strings.Repeat("a", 500), "has space", "ab"} {
+		t.Run(code[:min(len(code), 10)], func(t *testing.T) {
+			db := useFakeDB(t)
+			request := newRequest("GET", "/x", "")
+			request.PathParameters["shortURL"] = code
+			if response := serve(t, request); response.StatusCode != 404 {
+				t.Fatalf("status = %d, want 404", response.StatusCode)
+			}
+			if db.called("GetItem") != 0 {
+				t.Fatal("a malformed code was looked up")
+			}
+		})
+	}
+}
+
+func TestCreateRetriesConditionalFailures(t *testing.T) {
+	// rejectPuts makes the first n PutItems fail their condition
+	rejectPuts := func(db *fakeDB, n int) {
+		rejected := 0
+		db.before = func(ctx context.Context, op string, input any) error {
+			if op == "PutItem" && rejected < n {
+				rejected++
+				return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+			}
+			return nil
+		}
+	}
+
+	t.Run("fails once then succeeds", func(t *testing.T) {
+		db := useFakeDB(t)
+		rejectPuts(db, 1)
+		created := createLink(t, `{"long_url":"https://example.com"}`)
+		if db.called("PutItem") != 2 || db.mapping(t, created.ShortURL) == nil {
+			t.Fatalf("create stored %q after %d PutItems", created.ShortURL, db.called("PutItem"))
+		}
+	})
+	t.Run("every attempt collides", func(t *testing.T) {
+		db := useFakeDB(t)
+		rejectPuts(db, maxCreateAttempts)
+		response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com"}`))
+		var body map[string]string
+		decode(t, response, &body)
+		if response.StatusCode != 500 || body["error"] != "Could not generate a unique short code" {
+			t.Fatalf("exhausted retries = %d %s", response.StatusCode, response.Body)
+		}
+		if db.called("PutItem") != maxCreateAttempts {
+			t.Fatalf("%d PutItems, want %d", db.called("PutItem"), maxCreateAttempts)
+		}
+	})
+}
+
+// tenantRequest builds a request as the /{tenant}/{shortURL} resource delivers it
+func tenantRequest(method, tenant, code string) events.APIGatewayProxyRequest {
+	request := newRequest(method, "/"+tenant+"/"+code, "")
+	request.PathParameters["tenant"] = tenant
+	request.PathParameters["shortURL"] = code
+	return request
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com", AccessCount: 2})
+
+	if response := serve(t, newRequest("DELETE", "/api/abc1234", "")); response.StatusCode != 204 {
+		t.Fatalf("delete = %d", response.StatusCode)
+	}
+	if db.called("DeleteItem") != 0 {
+		t.Fatal("delete removed the item instead of soft-deleting it")
+	}
+	stored := db.mapping(t, "abc1234")
+	if stored == nil || stored.DeletedAt == 0 {
+		t.Fatalf("stored = %+v, want deleted_at set", stored)
+	}
+
+	if response := serve(t, newRequest("GET", "/abc1234", "")); response.StatusCode != 410 {
+		t.Fatalf("deleted redirect = %d, want 410", response.StatusCode)
+	}
+	if got := db.mapping(t, "abc1234").AccessCount; got != 2 {
+		t.Fatalf("access_count = %d after a deleted hit, want 2", got)
+	}
+
+	if response := serve(t, newRequest("POST", "/api/abc1234/restore", "")); response.StatusCode != 200 {
+		t.Fatalf("restore = %d %s", response.StatusCode, response.Body)
+	}
+	if response := serve(t, newRequest("GET", "/abc1234", "")); response.StatusCode != 302 {
+		t.Fatalf("restored redirect = %d, want 302", response.StatusCode)
+	}
+
+	t.Run("past retention", func(t *testing.T) {
+		seedLink(t, db, URLMapping{ShortURL: "old1234", LongURL: "https://example.com",
+			DeletedAt: time.Now().Add(-softDeleteRetention - time.Hour).Unix()})
+		if response := serve(t, newRequest("POST", "/api/old1234/restore", "")); response.StatusCode < 400 {
+			t.Fatalf("restore past retention = %d, want an error", response.StatusCode)
+		}
+	})
+}
+
+func TestCreateReturnsFullShortURL(t *testing.T) {
+	for _, base := range []string{"https://short.example.com", "https://short.example.com/"} {
+		t.Run(base, func(t *testing.T) {
+			useFakeDB(t)
+			setVar(t, &shortURLBase, base)
+			created := createLink(t, `{"long_url":"https://example.com","custom_alias":"xyz123"}`)
+			if created.ShortURLFull != "https://short.example.com/xyz123" {
+				t.Fatalf("short_url_full = %q", created.ShortURLFull)
+			}
+		})
+	}
+	t.Run("from Host", func(t *testing.T) {
+		useFakeDB(t)
+		setVar(t, &shortURLBase, "")
+		created := createLink(t, `{"long_url":"https://example.com","custom_alias":"xyz123"}`)
+		if created.ShortURLFull != "https://sho.rt/xyz123" {
+			t.Fatalf("short_url_full = %q", created.ShortURLFull)
+		}
+	})
+}
+
+func TestLongURLLengthLimit(t *testing.T) {
+	setVar(t, &maxLongURLLength, 40)
+	base := "https://example.com/"
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{"under", base + strings.Repeat("a", 19), 201},
+		{"at", base + strings.Repeat("a", 20), 201},
+		{"over", base + strings.Repeat("a", 21), 400},
+		{"over in bytes", base + strings.Repeat("é", 11), 400}, // 11 runes, 22 bytes
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeDB(t)
+			response := serve(t, newRequest("POST", "/", `{"long_url":"`+tt.url+`"}`))
+			if response.StatusCode != tt.status {
+				t.Fatalf("%d-byte url = %d, want %d", len(tt.url), response.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestCaseInsensitiveCodes(t *testing.T) {
+	setVar(t, &caseInsensitiveCodes, true)
+
+	t.Run("mixed-case lookups", func(t *testing.T) {
+		db := useFakeDB(t)
+		createLink(t, `{"long_url":"https://example.com","custom_alias":"AbC123"}`)
+		if db.mapping(t, "abc123") == nil {
+			t.Fatal("alias was not stored in lowercase")
+		}
+		for _, code := range []string{"abc123", "ABC123", "aBc123"} {
+			if response := serve(t, newRequest("GET", "/"+code, "")); response.StatusCode != 302 {
+				t.Fatalf("/%s = %d, want 302", code, response.StatusCode)
+			}
+		}
+	})
+
+	t.Run("generator", func(t *testing.T) {
+		t.Setenv("SHORT_CODE_CHARSET", "ABCdef123")
+		setVar(t, &shortCodeCharset, envShortCodeCharset())
+		if shortCodeCharset != "abcdef123" {
+			t.Fatalf("charset = %q, want it lowercased", shortCodeCharset)
+		}
+		for i := 0; i < 50; i++ {
+			if code := generateShortCode(12); code != strings.ToLower(code) {
+				t.Fatalf("generated %q in case-insensitive mode", code)
+			}
+		}
+	})
+
+	t.Run("off", func(t *testing.T) {
+		setVar(t, &caseInsensitiveCodes, false)
+		useFakeDB(t)
+		createLink(t, `{"long_url":"https://example.com","custom_alias":"AbC123"}`)
+		if response := serve(t, newRequest("GET", "/abc123", "")); response.StatusCode != 404 {
+			t.Fatalf("/abc123 = %d, want 404 with case-sensitive codes", response.StatusCode)
+		}
+	})
+}
+
+func TestMaxClicks(t *testing.T) {
+	t.Run("single use", func(t *testing.T) {
+		db := useFakeDB(t)
+		created := createLink(t, `{"long_url":"https://example.com/invite","max_clicks":1}`)
+		if response := serve(t, newRequest("GET", "/"+created.ShortURL, "")); response.StatusCode != 302 {
+			t.Fatalf("first click = %d, want 302", response.StatusCode)
+		}
+		if response := serve(t, newRequest("GET", "/"+created.ShortURL, "")); response.StatusCode != 410 {
+			t.Fatalf("second click = %d, want 410", response.StatusCode)
+		}
+		if got := db.mapping(t, created.ShortURL).AccessCount; got != 1 {
+			t.Fatalf("access_count = %d, want 1", got)
+		}
+	})
+
+	t.Run("concurrent clicks", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com", MaxClicks: 3})
+
+		const clicks = 20
+		statuses := make(chan int, clicks)
+		var wg sync.WaitGroup
+		for i := 0; i < clicks; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				response, _ := handleRequest(context.Background(), newRequest("GET", "/abc1234", ""))
+				statuses <- response.StatusCode
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+
+		counts := map[int]int{}
+		for status := range statuses {
+			counts[status]++
+		}
+		if counts[302] != 3 || counts[410] != clicks-3 {
+			t.Fatalf("statuses = %v, want 3 redirects and %d 410s", counts, clicks-3)
+		}
+		if got := db.mapping(t, "abc1234").AccessCount; got != 3 {
+			t.Fatalf("access_count = %d, want 3", got)
+		}
+	})
+}
+
+func TestUnsupportedMethodListsAllow(t *testing.T) {
+	useFakeDB(t)
+	response := serve(t, newRequest("HEAD", "/abc1234", ""))
+	if response.StatusCode != 405 {
+		t.Fatalf("status = %d, want 405", response.StatusCode)
+	}
+	if got := response.Headers["Allow"]; got != "GET, POST, PUT, PATCH, DELETE, OPTIONS" {
+		t.Fatalf("Allow = %q", got)
+	}
+	var body map[string]string
+	decode(t, response, &body)
+	if body["error"] == "" {
+		t.Fatalf("body %s has no error", response.Body)
+	}
+}
+
+func TestNotFoundRedirect(t *testing.T) {
+	t.Run("configured", func(t *testing.T) {
+		db := useFakeDB(t)
+		setVar(t, &notFoundRedirect, "https://example.com/not-found")
+		response := serve(t, newRequest("GET", "/missing1", ""))
+		if response.StatusCode != 302 || response.Headers["Location"] != "https://example.com/not-found" {
+			t.Fatalf("unknown code = %d %q", response.StatusCode, response.Headers["Location"])
+		}
+
+		// Expired and deleted links keep their 410
+		seedLink(t, db, URLMapping{ShortURL: "expired1", LongURL: "https://example.com", ExpiresAt: time.Now().Unix() - 60})
+		seedLink(t, db, URLMapping{ShortURL: "deleted1", LongURL: "https://example.com", DeletedAt: time.Now().Unix()})
+		for _, code := range []string{"expired1", "deleted1"} {
+			if response := serve(t, newRequest("GET", "/"+code, "")); response.StatusCode != 410 {
+				t.Fatalf("/%s = %d, want 410", code, response.StatusCode)
+			}
+		}
+	})
+	t.Run("unconfigured", func(t *testing.T) {
+		useFakeDB(t)
+		setVar(t, &notFoundRedirect, "")
+		request := newRequest("GET", "/missing1", "")
+		request.Headers["Accept"] = "application/json"
+		response := serve(t, request)
+		var body map[string]string
+		decode(t, response, &body)
+		if response.StatusCode != 404 || body["error"] != "URL not found" {
+			t.Fatalf("unknown code = %d %s", response.StatusCode, response.Body)
+		}
+	})
+}
+
+func TestLegacyItems(t *testing.T) {
+	t.Run("missing long_url", func(t *testing.T) {
+		db := useFakeDB(t)
+		db.put("urls", map[string]types.AttributeValue{
+			"short_url":    &types.AttributeValueMemberS{Value: "legacy1"},
+			"access_count": &types.AttributeValueMemberN{Value: "4"},
+		})
+		response := serve(t, newRequest("GET", "/legacy1", ""))
+		if response.StatusCode != 500 || response.Headers["Location"] != "" {
+			t.Fatalf("redirect = %d to %q, want a 500 with no Location", response.StatusCode, response.Headers["Location"])
+		}
+		var body map[string]string
+		decode(t, response, &body)
+		if body["error"] != "Stored URL is malformed" {
+			t.Fatalf("body = %s", response.Body)
+		}
+	})
+	t.Run("missing access_count", func(t *testing.T) {
+		db := useFakeDB(t)
+		db.put("urls", map[string]types.AttributeValue{
+			"short_url": &types.AttributeValueMemberS{Value: "legacy2"},
+			"long_url":  &types.AttributeValueMemberS{Value: "https://example.com"},
+		})
+		if response := serve(t, newRequest("GET", "/legacy2", "")); response.StatusCode != 302 {
+			t.Fatalf("redirect = %d, want 302", response.StatusCode)
+		}
+		if got := db.mapping(t, "legacy2").AccessCount; got != 1 {
+			t.Fatalf("access_count = %d, want it counted from zero", got)
+		}
+	})
+}
+
+func TestRequestBodySizeLimit(t *testing.T) {
+	setVar(t, &maxBodyBytes, 100)
+	body := func(size int) string {
+		prefix := `{"long_url":"https://example.com/`
+		return prefix + strings.Repeat("a", size-len(prefix)-2) + `"}`
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		encoded bool
+		status  int
+	}{
+		{"just under", body(100), false, 201},
+		{"just over", body(101), false, 413},
+		{"base64 just under", body(100), true, 201},
+		{"base64 just over", body(101), true, 413},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t)
+			request := newRequest("POST", "/", tt.body)
+			if tt.encoded {
+				request.Body = base64.StdEncoding.EncodeToString([]byte(tt.body))
+				request.IsBase64Encoded = true
+			}
+			if response := serve(t, request); response.StatusCode != tt.status {
+				t.Fatalf("%d-byte body = %d, want %d", len(tt.body), response.StatusCode, tt.status)
+			}
+			if tt.status == 413 && db.called("PutItem") != 0 {
+				t.Fatal("an oversized body was stored")
+			}
+		})
+	}
+}
+
+func TestCreateRejectsPrivateHosts(t *testing.T) {
+	tests := []struct {
+		longURL string
+		status  int
+	}{
+		{"https://example.com", 201},
+		{"http://localhost:8080/admin", 400},
+		{"http://127.0.0.1/", 400},
+		{"http://169.254.169.254/latest/meta-data/", 400},
+		{"http://10.0.0.5/", 400},
+		{"http://[::1]/", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.longURL, func(t *testing.T) {
+			useFakeDB(t)
+			if response := serve(t, newRequest("POST", "/", `{"long_url":"`+tt.longURL+`"}`)); response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+		})
+	}
+
+	t.Run("allowed for internal deployments", func(t *testing.T) {
+		useFakeDB(t)
+		setVar(t, &allowPrivateHosts, true)
+		createLink(t, `{"long_url":"http://169.254.169.254/"}`)
+	})
+}
+
+func TestShortCodeLengthSetting(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", defaultShortCodeLength},
+		{"10", 10},
+		{"4", 4},
+		{"16", 16},
+		{"3", defaultShortCodeLength},
+		{"17", defaultShortCodeLength},
+		{"seven", defaultShortCodeLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("SHORT_CODE_LENGTH", tt.value)
+			if got := envShortCodeLength(); got != tt.want {
+				t.Fatalf("length = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("generator honors it", func(t *testing.T) {
+		useFakeDB(t)
+		setVar(t, &shortCodeLength, 12)
+		if created := createLink(t, `{"long_url":"https://example.com"}`); len(created.ShortURL) != 12 {
+			t.Fatalf("code %q has length %d, want 12", created.ShortURL, len(created.ShortURL))
+		}
+	})
+}
+
+func TestRedirectCacheControl(t *testing.T) {
+	setVar(t, &permanentRedirectMaxAge, 600)
+	want := map[int]string{
+		301: "public, max-age=600",
+		302: "no-cache",
+		307: "no-cache",
+		308: "public, max-age=600",
+	}
+	for code, cacheControl := range want {
+		t.Run(strconv.Itoa(code), func(t *testing.T) {
+			db := useFakeDB(t)
+			seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com", RedirectCode: code})
+			response := serve(t, newRequest("GET", "/abc1234", ""))
+			if response.StatusCode != code || response.Headers["Cache-Control"] != cacheControl {
+				t.Fatalf("redirect = %d %q, want %d %q", response.StatusCode, response.Headers["Cache-Control"], code, cacheControl)
+			}
+		})
+	}
+}
+
+func TestClientInitFailureReturns500(t *testing.T) {
+	// A profile that doesn't exist makes LoadDefaultConfig fail
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", dir+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", dir+"/credentials")
+	t.Setenv("AWS_PROFILE", "missing-profile")
+	setVar(t, &ddbClient, nil)
+
+	response := serve(t, newRequest("GET", "/abc1234", ""))
+	var body map[string]string
+	decode(t, response, &body)
+	if response.StatusCode != 500 || body["error"] != "Service is not configured correctly" {
+		t.Fatalf("response = %d %s", response.StatusCode, response.Body)
+	}
+	if ddbClient != nil {
+		t.Fatal("a failed setup left a client behind")
+	}
+
+	// The next request tries again once the config is fixed
+	t.Setenv("AWS_PROFILE", "")
+	if _, err := getClient(context.Background()); err != nil {
+		t.Fatalf("getClient after fixing the config: %v", err)
+	}
+}
+
+func TestConsistentReadsSetting(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(strconv.FormatBool(enabled), func(t *testing.T) {
+			db := useFakeDB(t)
+			setVar(t, &consistentReads, enabled)
+			seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+
+			serve(t, newRequest("GET", "/abc1234", ""))
+			if len(db.getInputs) != 1 {
+				t.Fatalf("%d GetItems, want 1", len(db.getInputs))
+			}
+			if got := aws.ToBool(db.getInputs[0].ConsistentRead); got != enabled {
+				t.Fatalf("ConsistentRead = %v, want %v", got, enabled)
+			}
+		})
+	}
+}
+
+func TestCreateChecksContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		status      int
+	}{
+		{"application/json", 201},
+		{"application/json; charset=utf-8", 201},
+		{"", 201},
+		{"text/plain", 415},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			db := useFakeDB(t)
+			request := newRequest("POST", "/", `{"long_url":"https://example.com"}`)
+			request.Headers["Content-Type"] = tt.contentType
+			if tt.contentType == "" {
+				delete(request.Headers, "Content-Type")
+			}
+
+			response := serve(t, request)
+			if response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d: %s", response.StatusCode, tt.status, response.Body)
+			}
+			if tt.status == 415 {
+				var body map[string]string
+				decode(t, response, &body)
+				if body["error"] == "" || db.called("PutItem") != 0 {
+					t.Fatalf("415 body = %q, PutItem calls = %d", response.Body, db.called("PutItem"))
+				}
+			}
+		})
+	}
+}
+
+func TestCreateFromFormBody(t *testing.T) {
+	db := useFakeDB(t)
+	request := newRequest("POST", "/", "long_url=https%3A%2F%2Fexample.com%2Fform%3Fa%3D1&custom_alias=formlink")
+	request.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+
+	response := serve(t, request)
+	var created URLMapping
+	decode(t, response, &created)
+	if response.StatusCode != 201 || created.ShortURL != "formlink" || created.LongURL != "https://example.com/form?a=1" {
+		t.Fatalf("form create = %d %+v", response.StatusCode, created)
+	}
+	if stored := db.mapping(t, "formlink"); stored.LongURL != "https://example.com/form?a=1" {
+		t.Fatalf("stored long_url = %q", stored.LongURL)
+	}
+
+	// The form and JSON paths share validation
+	request = newRequest("POST", "/", "long_url=ftp%3A%2F%2Fexample.com")
+	request.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+	if response := serve(t, request); response.StatusCode != 400 {
+		t.Fatalf("invalid form URL = %d, want 400", response.StatusCode)
+	}
+}
+
+func TestExpiredGraceRedirect(t *testing.T) {
+	hourAgo := time.Now().Add(-time.Hour).Unix()
+	tests := []struct {
+		name     string
+		page     string
+		grace    time.Duration
+		status   int
+		location string
+	}{
+		{"inside the grace window", "https://sho.rt/expired", 2 * time.Hour, 302, "https://sho.rt/expired"},
+		{"after the grace window", "https://sho.rt/expired", 30 * time.Minute, 410, ""},
+		{"no expired page", "", 2 * time.Hour, 410, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t)
+			setVar(t, &expiredRedirect, tt.page)
+			setVar(t, &expiredGracePeriod, tt.grace)
+			seedLink(t, db, URLMapping{ShortURL: "gone001", LongURL: "https://example.com", ExpiresAt: hourAgo, AccessCount: 4})
+
+			response := serve(t, newRequest("GET", "/gone001", ""))
+			if response.StatusCode != tt.status || response.Headers["Location"] != tt.location {
+				t.Fatalf("response = %d %q, want %d %q", response.StatusCode, response.Headers["Location"], tt.status, tt.location)
+			}
+			if got := db.mapping(t, "gone001").AccessCount; got != 4 {
+				t.Fatalf("access_count = %d, an expired link shouldn't count", got)
+			}
+		})
+	}
+}
+
+func TestMetadataETag(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "etag001", LongURL: "https://example.com"})
+
+	first := serve(t, newRequest("GET", "/api/etag001", ""))
+	etag := first.Headers["ETag"]
+	if first.StatusCode != 200 || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("first = %d, ETag %q", first.StatusCode, etag)
+	}
+
+	request := newRequest("GET", "/api/etag001", "")
+	request.Headers["If-None-Match"] = etag
+	if response := serve(t, request); response.StatusCode != 304 || response.Body != "" || response.Headers["ETag"] != etag {
+		t.Fatalf("matching If-None-Match = %d %q", response.StatusCode, response.Body)
+	}
+	request.Headers["If-None-Match"] = `"other", W/` + etag
+	if response := serve(t, request); response.StatusCode != 304 {
+		t.Fatalf("weak tag in a list = %d, want 304", response.StatusCode)
+	}
+
+	// A click changes access_count, so the old tag no longer matches
+	serve(t, newRequest("GET", "/etag001", ""))
+	request.Headers["If-None-Match"] = etag
+	response := serve(t, request)
+	if response.StatusCode != 200 || response.Headers["ETag"] == etag {
+		t.Fatalf("after a click = %d, ETag %q", response.StatusCode, response.Headers["ETag"])
+	}
+}
+
+func TestGeneratedCodesUseTheCharset(t *testing.T) {
+	if strings.ContainsAny(defaultShortCodeCharset, "ILOUilou") {
+		t.Fatalf("default charset %q has ambiguous characters", defaultShortCodeCharset)
+	}
+	for i := 0; i < 200; i++ {
+		code := generateShortCode(shortCodeLength)
+		if strings.ContainsAny(code, "ILOUilou") || strings.Trim(code, shortCodeCharset) != "" {
+			t.Fatalf("code %q isn't drawn from %q", code, shortCodeCharset)
+		}
+	}
+
+	t.Run("custom charset", func(t *testing.T) {
+		setVar(t, &shortCodeCharset, "ab")
+		if code := generateShortCode(12); strings.Trim(code, "ab") != "" {
+			t.Fatalf("code %q isn't drawn from ab", code)
+		}
+		if validateCharset("x") == nil || validateCharset("a b") == nil || validateCharset("aa") == nil {
+			t.Fatal("invalid charsets were accepted")
+		}
+	})
+
+	t.Run("strict aliases", func(t *testing.T) {
+		useFakeDB(t)
+		setVar(t, &strictAliasCharset, true)
+		if response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"l0go11"}`)); response.StatusCode != 400 {
+			t.Fatalf("alias outside the charset = %d, want 400", response.StatusCode)
+		}
+		setVar(t, &strictAliasCharset, false)
+		createLink(t, `{"long_url":"https://example.com","custom_alias":"l0go11"}`)
+	})
+}
+
+func TestEncodingFailuresReturn500(t *testing.T) {
+	response, err := jsonResponse(201, map[string]any{"unencodable": make(chan int)})
+	if err == nil || response.StatusCode != 500 {
+		t.Fatalf("jsonResponse = %d, %v; want a 500 and the error", response.StatusCode, err)
+	}
+	var body map[string]string
+	decode(t, response, &body)
+	if body["error"] != "Error encoding response" {
+		t.Fatalf("body = %q", response.Body)
+	}
+
+	// The handler logs route errors and still hands API Gateway the 500 body
+	db := useFakeDB(t)
+	db.before = func(ctx context.Context, op string, input any) error {
+		return errors.New("dynamodb is down")
+	}
+	response, err = handleRequest(context.Background(), newRequest("GET", "/api/abc1234", ""))
+	if err != nil {
+		t.Fatalf("handler returned an error, so API Gateway would drop the body: %v", err)
+	}
+	decode(t, response, &body)
+	if response.StatusCode != 500 || body["error"] != "Error querying DynamoDB" {
+		t.Fatalf("response = %d %s", response.StatusCode, response.Body)
+	}
+
+	// JSON can't hold a five-digit year, which a numeric created_at can reach
+	db = useFakeDB(t)
+	db.seed(t, "urls", map[string]any{"short_url": "abc1234", "long_url": "https://example.com",
+		"created_at": time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC).Unix()})
+	response = serve(t, newRequest("GET", "/api/abc1234", ""))
+	decode(t, response, &body)
+	if response.StatusCode != 500 || body["error"] != "Error encoding response" {
+		t.Fatalf("unencodable info = %d %s, want a 500", response.StatusCode, response.Body)
+	}
+}
+
+func TestAllowedSchemes(t *testing.T) {
+	tests := []struct {
+		name    string
+		schemes string
+		allowed []string
+		refused []string
+	}{
+		{"default", "http,https", []string{"http://example.com", "https://example.com"}, []string{"myapp://open/item/7", "mailto:a@example.com"}},
+		{"deep links", "https,myapp", []string{"https://example.com", "myapp://open/item/7"}, []string{"http://example.com", "otherapp://open"}},
+		{"https only", "https", []string{"https://example.com"}, []string{"http://example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVar(t, &allowedSchemes, schemeSet(tt.schemes))
+			for _, u := range tt.allowed {
+				if err := validateLongURL(u); err != nil {
+					t.Errorf("%s refused: %v", u, err)
+				}
+			}
+			for _, u := range tt.refused {
+				if validateLongURL(u) == nil {
+					t.Errorf("%s accepted", u)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentRedirectsCountAtomically(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "busy001", LongURL: "https://example.com", AccessCount: 10})
+	var expressions sync.Map
+	db.before = func(ctx context.Context, op string, input any) error {
+		if update, ok := input.(*dynamodb.UpdateItemInput); ok {
+			expressions.Store(*update.UpdateExpression, true)
+		}
+		return nil
+	}
+
+	const clicks = 40
+	var wg sync.WaitGroup
+	for i := 0; i < clicks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if response, err := handleRequest(context.Background(), newRequest("GET", "/busy001", "")); err != nil || response.StatusCode != 302 {
+				t.Errorf("redirect = %d, %v", response.StatusCode, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := db.mapping(t, "busy001").AccessCount; got != 10+clicks {
+		t.Fatalf("access_count = %d, want %d", got, 10+clicks)
+	}
+
+	// The count is an ADD, so no write depends on a value read earlier
+	expressions.Range(func(expression, _ any) bool {
+		if !strings.Contains(expression.(string), "ADD #ac :inc") {
+			t.Errorf("update expression = %q, want an atomic ADD", expression)
+		}
+		return true
+	})
+}
+
+func TestNotFoundNegotiatesJSONOrHTML(t *testing.T) {
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"application/json", "application/json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html; charset=utf-8"},
+		{"", "text/html; charset=utf-8"},
+		{"text/html;q=0.5, application/json", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			useFakeDB(t)
+			request := newRequest("GET", "/missing1", "")
+			request.Headers["Accept"] = tt.accept
+
+			response := serve(t, request)
+			if response.StatusCode != 404 || response.Headers["Content-Type"] != tt.contentType {
+				t.Fatalf("response = %d %q, want 404 %q", response.StatusCode, response.Headers["Content-Type"], tt.contentType)
+			}
+			if strings.HasPrefix(tt.contentType, "text/html") && !strings.Contains(response.Body, "<html") {
+				t.Fatalf("HTML body = %q", response.Body)
+			}
+		})
+	}
+}
+
+func TestDisableAndEnable(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "pause01", LongURL: "https://example.com", AccessCount: 5})
+
+	patch := func(body string) events.APIGatewayProxyResponse {
+		t.Helper()
+		return serve(t, newRequest("PATCH", "/api/pause01", body))
+	}
+
+	if response := patch(`{"enabled":false}`); response.StatusCode != 200 {
+		t.Fatalf("disable = %d %s", response.StatusCode, response.Body)
+	}
+	for i := 0; i < 2; i++ {
+		if response := serve(t, newRequest("GET", "/pause01", "")); response.StatusCode != 403 {
+			t.Fatalf("disabled redirect = %d, want 403", response.StatusCode)
+		}
+	}
+	if got := db.mapping(t, "pause01").AccessCount; got != 5 {
+		t.Fatalf("access_count = %d while disabled, want 5", got)
+	}
+
+	t.Run("configured page", func(t *testing.T) {
+		setVar(t, &disabledRedirect, "https://sho.rt/paused")
+		response := serve(t, newRequest("GET", "/pause01", ""))
+		if response.StatusCode != 302 || response.Headers["Location"] != "https://sho.rt/paused" {
+			t.Fatalf("disabled redirect = %d %q", response.StatusCode, response.Headers["Location"])
+		}
+	})
+
+	if response := patch(`{"enabled":true}`); response.StatusCode != 200 {
+		t.Fatalf("enable = %d %s", response.StatusCode, response.Body)
+	}
+	if response := serve(t, newRequest("GET", "/pause01", "")); response.StatusCode != 302 {
+		t.Fatalf("re-enabled redirect = %d, want 302", response.StatusCode)
+	}
+	if got := db.mapping(t, "pause01").AccessCount; got != 6 {
+		t.Fatalf("access_count = %d after re-enabling, want 6", got)
+	}
+
+	if response := patch(`{}`); response.StatusCode != 400 {
+		t.Fatalf("patch without enabled = %d, want 400", response.StatusCode)
+	}
+	if response := serve(t, newRequest("PATCH", "/api/missing1", `{"enabled":false}`)); response.StatusCode != 404 {
+		t.Fatalf("patch of an unknown code = %d, want 404", response.StatusCode)
+	}
+}
+
+func TestReuseExistingSkipsLinksThatDontRedirect(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		stored URLMapping
+	}{
+		{"paused", URLMapping{Enabled: aws.Bool(false)}},
+		{"out of clicks", URLMapping{MaxClicks: 3, AccessCount: 3}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t)
+			stored := tt.stored
+			stored.ShortURL, stored.LongURL = "old0001", "https://example.com/a"
+			seedLink(t, db, stored)
+
+			got := createLink(t, `{"long_url":"https://example.com/a","reuse_existing":true}`)
+			if got.ShortURL == "old0001" {
+				t.Fatalf("reuse_existing handed back a %s link", tt.name)
+			}
+		})
+	}
+}
+
+func TestBase64Bodies(t *testing.T) {
+	db := useFakeDB(t)
+
+	request := newRequest("POST", "/", base64.StdEncoding.EncodeToString([]byte(`{"long_url":"https://example.com/b64","custom_alias":"b64link"}`)))
+	request.IsBase64Encoded = true
+	response := serve(t, request)
+	if response.StatusCode != 201 || db.mapping(t, "b64link").LongURL != "https://example.com/b64" {
+		t.Fatalf("base64 create = %d %s", response.StatusCode, response.Body)
+	}
+
+	request = newRequest("POST", "/", "eyJsb25nX3VybCI6!!not base64")
+	request.IsBase64Encoded = true
+	response = serve(t, request)
+	var body map[string]string
+	decode(t, response, &body)
+	if response.StatusCode != 400 || body["error"] != "request body is not valid base64" {
+		t.Fatalf("corrupt base64 = %d %s", response.StatusCode, response.Body)
+	}
+	if db.called("PutItem") != 1 {
+		t.Fatalf("PutItem calls = %d, want only the valid create", db.called("PutItem"))
+	}
+}
+
+func TestRedirectAsJSON(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "json001", LongURL: "https://example.com/data", Permanent: true})
+
+	request := newRequest("GET", "/json001", "")
+	request.Headers["Accept"] = "application/json"
+	response := serve(t, request)
+	var body ResolvedURLResponse
+	decode(t, response, &body)
+	if response.StatusCode != 200 || body.LongURL != "https://example.com/data" || response.Headers["Location"] != "" {
+		t.Fatalf("JSON redirect = %d %s %v", response.StatusCode, response.Body, response.Headers)
+	}
+	if response.Headers["Vary"] != "Accept" {
+		t.Fatalf("Vary = %q, caches must key on Accept", response.Headers["Vary"])
+	}
+
+	// Browsers still get the redirect
+	request.Headers["Accept"] = "text/html,*/*;q=0.8"
+	response = serve(t, request)
+	if response.StatusCode != 301 || response.Headers["Location"] != "https://example.com/data" {
+		t.Fatalf("browser redirect = %d %q", response.StatusCode, response.Headers["Location"])
+	}
+
+	if got := db.mapping(t, "json001").AccessCount; got != 2 {
+		t.Fatalf("access_count = %d, want both requests counted", got)
+	}
+}
+
+func TestRedirectReadsOnlyWhatItNeeds(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "proj001", LongURL: "https://example.com", RedirectCode: 307, CreatedBy: "user-1"})
+
+	response := serve(t, newRequest("GET", "/proj001", ""))
+	if response.StatusCode != 307 || response.Headers["Location"] != "https://example.com" {
+		t.Fatalf("redirect = %d %q", response.StatusCode, response.Headers["Location"])
+	}
+
+	in := db.getInputs[0]
+	if in.ProjectionExpression == nil {
+		t.Fatal("redirect GetItem has no ProjectionExpression")
+	}
+	projected := map[string]bool{}
+	for _, placeholder := range strings.Split(*in.ProjectionExpression, ", ") {
+		projected[in.ExpressionAttributeNames[placeholder]] = true
+	}
+	for _, attribute := range redirectAttributes {
+		if !projected[attribute] {
+			t.Errorf("projection is missing %s", attribute)
+		}
+	}
+	if projected["created_by"] || projected["preview_title"] {
+		t.Errorf("projection reads metadata the redirect doesn't use: %s", *in.ProjectionExpression)
+	}
+
+	// Metadata still returns the whole item
+	serve(t, newRequest("GET", "/api/proj001", ""))
+	if in := db.getInputs[len(db.getInputs)-1]; in.ProjectionExpression != nil {
+		t.Fatalf("metadata projection = %q, want the full item", *in.ProjectionExpression)
+	}
+}
+
+func TestRedirectUpdatesLastAccessed(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "last001", LongURL: "https://example.com", AccessCount: 3})
+	var updates []*dynamodb.UpdateItemInput
+	var mu sync.Mutex
+	db.before = func(ctx context.Context, op string, input any) error {
+		if update, ok := input.(*dynamodb.UpdateItemInput); ok {
+			mu.Lock()
+			updates = append(updates, update)
+			mu.Unlock()
+		}
+		return nil
+	}
+
+	before := time.Now().Add(-time.Second)
+	serve(t, newRequest("GET", "/last001", ""))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) != 1 {
+		t.Fatalf("%d updates, want the count and timestamp in one", len(updates))
+	}
+	stored := db.mapping(t, "last001")
+	if stored.AccessCount != 4 || stored.LastAccessedAt == nil || stored.LastAccessedAt.Before(before) {
+		t.Fatalf("after a redirect access_count = %d, last_accessed_at = %v", stored.AccessCount, stored.LastAccessedAt)
+	}
+
+	var info URLMapping
+	decode(t, serve(t, newRequest("GET", "/api/last001", "")), &info)
+	if info.LastAccessedAt == nil || !info.LastAccessedAt.Equal(*stored.LastAccessedAt) {
+		t.Fatalf("metadata last_accessed_at = %v, want %v", info.LastAccessedAt, stored.LastAccessedAt)
+	}
+}
+
+func TestCaseVariantAliases(t *testing.T) {
+	alias := func(t *testing.T, name string) int {
+		t.Helper()
+		return serve(t, newRequest("POST", "/", `{"long_url":"https://example.com/`+name+`","custom_alias":"`+name+`"}`)).StatusCode
+	}
+
+	t.Run("case-sensitive", func(t *testing.T) {
+		setVar(t, &caseInsensitiveCodes, false)
+		db := useFakeDB(t)
+		if status := alias(t, "MyLink"); status != 201 {
+			t.Fatalf("first alias = %d", status)
+		}
+		// Variants are refused even here, so turning case-insensitivity on later is safe
+		for _, variant := range []string{"mylink", "MYLINK"} {
+			if status := alias(t, variant); status != 409 {
+				t.Fatalf("%s = %d, want 409", variant, status)
+			}
+		}
+		var available AvailabilityResponse
+		decode(t, serve(t, newRequest("GET", "/api/available/myLINK", "")), &available)
+		if available.Available {
+			t.Fatal("a case variant of a taken alias was reported available")
+		}
+		if db.mapping(t, "MyLink") == nil || len(db.items("urls")) != 1 {
+			t.Fatal("the alias wasn't stored under its own casing")
+		}
+
+		// Once case-insensitivity is on, the variant still can't shadow it
+		setVar(t, &caseInsensitiveCodes, true)
+		if status := alias(t, "mylink"); status != 409 {
+			t.Fatalf("mylink after the switch = %d, want 409", status)
+		}
+	})
+
+	t.Run("case-insensitive", func(t *testing.T) {
+		setVar(t, &caseInsensitiveCodes, true)
+		db := useFakeDB(t)
+		if status := alias(t, "MyLink"); status != 201 {
+			t.Fatalf("first alias = %d", status)
+		}
+		for _, variant := range []string{"mylink", "MYLINK"} {
+			if status := alias(t, variant); status != 409 {
+				t.Fatalf("%s = %d, want 409", variant, status)
+			}
+		}
+		if db.mapping(t, "mylink") == nil || len(db.items("urls")) != 1 {
+			t.Fatal("the alias wasn't reserved under its lowercase form")
+		}
+	})
+
+	t.Run("mixed-case key from before the switch", func(t *testing.T) {
+		setVar(t, &caseInsensitiveCodes, true)
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "OldLink", LongURL: "https://example.com/old"})
+		if status := alias(t, "OldLink"); status != 409 {
+			t.Fatalf("OldLink = %d, want 409 while the legacy key exists", status)
+		}
+		if db.mapping(t, "oldlink") != nil {
+			t.Fatal("a lowercase duplicate of the legacy key was stored")
+		}
+	})
+}
+
+func TestCreateSetsLocation(t *testing.T) {
+	useFakeDB(t)
+	response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"located"}`))
+	if response.StatusCode != 201 || response.Headers["Location"] != "/api/located" {
+		t.Fatalf("create = %d, Location %q", response.StatusCode, response.Headers["Location"])
+	}
+
+	// Following it gets the new link's metadata rather than a redirect
+	var info URLMapping
+	followed := serve(t, newRequest("GET", response.Headers["Location"], ""))
+	decode(t, followed, &info)
+	if followed.StatusCode != 200 || info.ShortURL != "located" {
+		t.Fatalf("GET %s = %d %s", response.Headers["Location"], followed.StatusCode, followed.Body)
+	}
+
+	t.Run("tenant codes", func(t *testing.T) {
+		request := newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"located"}`)
+		request.Headers["x-tenant"] = "acme"
+		response := serve(t, request)
+		if response.StatusCode != 201 || response.Headers["Location"] != "/acme/located?info=true" {
+			t.Fatalf("tenant create = %d, Location %q", response.StatusCode, response.Headers["Location"])
+		}
+	})
+}
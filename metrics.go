@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Metrics are written to stdout in CloudWatch embedded metric format (EMF),
+// which CloudWatch Logs turns into custom metrics without any API calls.
+var (
+	metricsEnabled             = os.Getenv("METRICS_ENABLED") != "false"
+	metricsNamespace           = envOrDefault("METRICS_NAMESPACE", "URLShortener")
+	metricsOutput    io.Writer = os.Stdout
+)
+
+// Metric names emitted by the handler
+const (
+	metricURLsCreated = "URLsCreated"
+	metricRedirects   = "Redirects"
+	metricNotFound    = "NotFound"
+	metricErrors      = "Errors"
+)
+
+// emfMetric describes one metric in an EMF directive
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// emfDirective tells CloudWatch which fields of the record are metrics
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+// emfMetadata is the _aws block of an EMF record
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// emfRecord builds an EMF log record counting one occurrence of name for method
+func emfRecord(name, method string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"_aws": emfMetadata{
+			Timestamp: now.UnixMilli(),
+			CloudWatchMetrics: []emfDirective{{
+				Namespace:  metricsNamespace,
+				Dimensions: [][]string{{"Method"}},
+				Metrics:    []emfMetric{{Name: name, Unit: "Count"}},
+			}},
+		},
+		"Method": method,
+		name:     1,
+	}
+}
+
+// emitMetric writes a count of one for name, unless metrics are disabled
+func emitMetric(name, method string) {
+	if !metricsEnabled {
+		return
+	}
+	record, err := json.Marshal(emfRecord(name, method, time.Now()))
+	if err != nil {
+		baseLogger.Error("Error encoding metric", slog.String("metric", name), slog.Any("error", err))
+		return
+	}
+	fmt.Fprintln(metricsOutput, string(record))
+}
+
+// redirectedKey is the context key for the flag markRedirected sets
+type redirectedKey struct{}
+
+// withRedirectFlag returns ctx carrying a flag for markRedirected, and a
+// function that reports whether it was set. A redirect can't be told from
+// the status alone: JSON clients get a 200, and a 304 is only a cache hit.
+func withRedirectFlag(ctx context.Context) (context.Context, func() bool) {
+	redirected := new(bool)
+	return context.WithValue(ctx, redirectedKey{}, redirected), func() bool { return *redirected }
+}
+
+// markRedirected records that the request sent a visitor on to a link's destination
+func markRedirected(ctx context.Context) {
+	if redirected, ok := ctx.Value(redirectedKey{}).(*bool); ok {
+		*redirected = true
+	}
+}
+
+// metricForResponse picks the metric to record for a finished request, if any
+func metricForResponse(method string, status int, redirected bool) string {
+	switch {
+	case status >= 500:
+		return metricErrors
+	case status == 404:
+		return metricNotFound
+	case method == "POST" && status == 201:
+		return metricURLsCreated
+	case redirected:
+		return metricRedirects
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMetricsAreEMF(t *testing.T) {
+	db := useFakeDB(t)
+	var buf bytes.Buffer
+	setVar(t, &metricsEnabled, true)
+	setVar[io.Writer](t, &metricsOutput, &buf)
+
+	created := createLink(t, `{"long_url":"https://example.com"}`)
+	serve(t, newRequest("GET", "/"+created.ShortURL, ""))
+	serve(t, newRequest("GET", "/api/missing1", ""))
+	db.before = func(ctx context.Context, op string, input any) error { return errors.New("boom") }
+	serve(t, newRequest("GET", "/"+created.ShortURL, ""))
+
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record struct {
+			AWS struct {
+				Timestamp         int64
+				CloudWatchMetrics []emfDirective
+			} `json:"_aws"`
+			Method string
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("metric line %q: %v", line, err)
+		}
+		directives := record.AWS.CloudWatchMetrics
+		if record.AWS.Timestamp == 0 || len(directives) != 1 || directives[0].Namespace != metricsNamespace ||
+			len(directives[0].Metrics) != 1 || record.Method == "" {
+			t.Fatalf("metric line %s is not a single-metric EMF record", line)
+		}
+		name := directives[0].Metrics[0].Name
+		var values map[string]any
+		json.Unmarshal([]byte(line), &values)
+		if values[name] != 1.0 {
+			t.Fatalf("metric line %s has no count for %s", line, name)
+		}
+		names = append(names, name)
+	}
+	want := []string{metricURLsCreated, metricRedirects, metricNotFound, metricErrors}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("metrics = %v, want %v", names, want)
+	}
+
+	buf.Reset()
+	setVar(t, &metricsEnabled, false)
+	serve(t, newRequest("GET", "/api/missing1", ""))
+	if buf.Len() != 0 {
+		t.Fatalf("disabled metrics still wrote %s", buf.String())
+	}
+}
+
+func TestRedirectMetricCountsRedirectsNotStatuses(t *testing.T) {
+	useFakeDB(t)
+	var buf bytes.Buffer
+	setVar(t, &metricsEnabled, true)
+	setVar[io.Writer](t, &metricsOutput, &buf)
+	created := createLink(t, `{"long_url":"https://example.com"}`)
+
+	// A 304 from the metadata route is a cache hit, not a redirect
+	etag := serve(t, newRequest("GET", "/api/"+created.ShortURL, "")).Headers["ETag"]
+	request := newRequest("GET", "/api/"+created.ShortURL, "")
+	request.Headers["If-None-Match"] = etag
+	if response := serve(t, request); response.StatusCode != 304 {
+		t.Fatalf("conditional metadata read = %d, want 304", response.StatusCode)
+	}
+
+	// A JSON client is redirected with a 200
+	request = newRequest("GET", "/"+created.ShortURL, "")
+	request.Headers["Accept"] = "application/json"
+	if response := serve(t, request); response.StatusCode != 200 {
+		t.Fatalf("JSON redirect = %d, want 200", response.StatusCode)
+	}
+
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record struct {
+			AWS emfMetadata `json:"_aws"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("metric line %q: %v", line, err)
+		}
+		names = append(names, record.AWS.CloudWatchMetrics[0].Metrics[0].Name)
+	}
+	if want := metricURLsCreated + "," + metricRedirects; strings.Join(names, ",") != want {
+		t.Fatalf("metrics = %v, want %s", names, want)
+	}
+}
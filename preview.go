@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	previewFetchTimeout = 3 * time.Second // Upper bound on fetching a destination page
+	previewMaxBodyBytes = 512 << 10       // Only the first 512KB of a page is parsed
+)
+
+// previewClient fetches destination pages for link previews
+// Redirects are capped so a hostile page can't bounce us around forever,
+// and none of them may lead to a private address
+var previewClient = &http.Client{
+	Timeout:   previewFetchTimeout,
+	Transport: publicOnlyTransport(),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// LinkPreview is the page metadata shown by dashboards next to a link
+type LinkPreview struct {
+	Title string
+	Image string
+}
+
+// fetchLinkPreview downloads longURL and extracts its <title> and og:image.
+// Any failure is logged and yields an empty preview so creates never fail on it.
+func fetchLinkPreview(ctx context.Context, longURL string) LinkPreview {
+	ctx, cancel := context.WithTimeout(ctx, previewFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, longURL, nil)
+	if err != nil {
+		loggerFrom(ctx).Warn("Could not build preview request", slog.Any("error", err))
+		return LinkPreview{}
+	}
+	req.Header.Set("Accept", "text/html")
+	setTraceHeaders(ctx, req)
+
+	resp, err := previewClient.Do(req)
+	if err != nil {
+		loggerFrom(ctx).Warn("Could not fetch link preview", slog.Any("error", err))
+		return LinkPreview{}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		loggerFrom(ctx).Warn("Link preview fetch returned an error status", slog.Int("status", resp.StatusCode))
+		return LinkPreview{}
+	}
+
+	return parseLinkPreview(io.LimitReader(resp.Body, previewMaxBodyBytes))
+}
+
+// parseLinkPreview scans an HTML document for its title and og:image
+func parseLinkPreview(r io.Reader) LinkPreview {
+	var preview LinkPreview
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			// io.EOF, a truncated body or broken markup all end the scan
+			return preview
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "title":
+				inTitle = preview.Title == ""
+			case "meta":
+				if preview.Image == "" && attr(token, "property") == "og:image" {
+					preview.Image = strings.TrimSpace(attr(token, "content"))
+				}
+			case "body":
+				// Title and og tags live in <head>, so stop once we're past it
+				if preview.Title != "" || preview.Image != "" {
+					return preview
+				}
+			}
+		case html.TextToken:
+			if inTitle {
+				preview.Title = strings.TrimSpace(string(tokenizer.Text()))
+				inTitle = false
+			}
+		case html.EndTagToken:
+			inTitle = false
+		}
+	}
+}
+
+// attr returns the value of the named attribute on token, or ""
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCreateFetchesLinkPreview(t *testing.T) {
+	setVar(t, &allowPrivateHosts, true)
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title> Launch day </title><meta property="og:image" content="https://cdn.example/launch.png"></head><body></body></html>`)
+	}))
+	defer page.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	setVar(t, &previewClient, &http.Client{Timeout: 50 * time.Millisecond, Transport: publicOnlyTransport()})
+
+	t.Run("og tags", func(t *testing.T) {
+		db := useFakeDB(t)
+		created := createLink(t, `{"long_url":"`+page.URL+`","fetch_metadata":true}`)
+		stored := db.mapping(t, created.ShortURL)
+		if stored.PreviewTitle != "Launch day" || stored.PreviewImage != "https://cdn.example/launch.png" {
+			t.Fatalf("preview = %q %q", stored.PreviewTitle, stored.PreviewImage)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		db := useFakeDB(t)
+		created := createLink(t, `{"long_url":"`+slow.URL+`","fetch_metadata":true}`)
+		stored := db.mapping(t, created.ShortURL)
+		if stored.PreviewTitle != "" || stored.PreviewImage != "" {
+			t.Fatalf("preview = %q %q, want empty", stored.PreviewTitle, stored.PreviewImage)
+		}
+	})
+	t.Run("private address", func(t *testing.T) {
+		setVar(t, &allowPrivateHosts, false)
+		// A fresh transport, so no connection dialed above is reused
+		setVar(t, &previewClient, &http.Client{Transport: publicOnlyTransport()})
+		if preview := fetchLinkPreview(context.Background(), page.URL); preview != (LinkPreview{}) {
+			t.Fatalf("fetched %+v from a loopback address", preview)
+		}
+	})
+}
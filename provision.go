@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// tableActiveTimeout bounds how long ensureTable waits for a new table
+const tableActiveTimeout = 2 * time.Minute
+
+// ensureTableEnabled has the function create the mappings table at cold start if it is missing
+var ensureTableEnabled = os.Getenv("ENSURE_TABLE") == "true"
+
+// provisionTable runs ensureTable before the function takes requests, so no
+// request waits on table creation. A failure is logged and requests then fail
+// on the missing table, the same as without ENSURE_TABLE. Creation counts
+// against Lambda's init timeout; a cold start that runs out simply retries.
+func provisionTable() {
+	ctx, cancel := context.WithTimeout(context.Background(), tableActiveTimeout)
+	defer cancel()
+
+	client, err := getClient(ctx)
+	if err == nil {
+		err = ensureTable(ctx, client)
+	}
+	if err != nil {
+		baseLogger.Error("Error ensuring DynamoDB table", slog.String("table", tableName), slog.Any("error", err))
+	}
+}
+
+// ensureTable creates tableName with the schema the handlers expect unless it
+// already exists, then waits for it to become ACTIVE. It is safe to call
+// repeatedly, including from several cold starts at once.
+func ensureTable(ctx context.Context, client DynamoDBAPI) error {
+	_, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &tableName})
+	if err == nil {
+		return nil
+	}
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return err
+	}
+
+	_, err = client.CreateTable(ctx, tableSchema())
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		// ResourceInUse means another container got there first
+		return err
+	}
+	baseLogger.Info("Creating DynamoDB table", slog.String("table", tableName))
+
+	waiter := dynamodb.NewTableExistsWaiter(client)
+	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: &tableName}, tableActiveTimeout)
+}
+
+// tableSchema describes the mappings table: short_url as the hash key, the
+// long_url GSI used to reuse codes, the alias_key GSI used to spot case
+// variants and, when configured, the top links GSI
+func tableSchema() *dynamodb.CreateTableInput {
+	allAttributes := &types.Projection{ProjectionType: types.ProjectionTypeAll}
+	input := &dynamodb.CreateTableInput{
+		TableName:   &tableName,
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("short_url"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("long_url"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("alias_key"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("short_url"), KeyType: types.KeyTypeHash},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+			IndexName: &longURLIndex,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("long_url"), KeyType: types.KeyTypeHash},
+			},
+			Projection: allAttributes,
+		}, {
+			IndexName: &aliasKeyIndex,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("alias_key"), KeyType: types.KeyTypeHash},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeKeysOnly},
+		}},
+	}
+
+	if topLinksIndex != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions,
+			types.AttributeDefinition{AttributeName: aws.String("rank_key"), AttributeType: types.ScalarAttributeTypeS},
+			types.AttributeDefinition{AttributeName: aws.String("access_count"), AttributeType: types.ScalarAttributeTypeN},
+		)
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, types.GlobalSecondaryIndex{
+			IndexName: &topLinksIndex,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("rank_key"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("access_count"), KeyType: types.KeyTypeRange},
+			},
+			Projection: allAttributes,
+		})
+	}
+	return input
+}
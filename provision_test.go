@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestEnsureTableCreatesOnce(t *testing.T) {
+	db := useFakeDB(t)
+	var created []*dynamodb.CreateTableInput
+	var mu sync.Mutex
+	db.before = func(ctx context.Context, op string, input any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		switch op {
+		case "DescribeTable":
+			if len(created) == 0 {
+				return &types.ResourceNotFoundException{Message: aws.String("no such table")}
+			}
+		case "CreateTable":
+			created = append(created, input.(*dynamodb.CreateTableInput))
+		}
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ensureTable(context.Background(), db); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if len(created) != 1 {
+		t.Fatalf("CreateTable calls = %d, want 1", len(created))
+	}
+	schema := created[0]
+	if *schema.TableName != "urls" || *schema.KeySchema[0].AttributeName != "short_url" || *schema.GlobalSecondaryIndexes[0].IndexName != longURLIndex {
+		t.Fatalf("schema = %+v", schema)
+	}
+
+	t.Run("another container created it first", func(t *testing.T) {
+		db := newFakeDB()
+		describes := 0
+		db.before = func(ctx context.Context, op string, input any) error {
+			switch op {
+			case "DescribeTable":
+				if describes++; describes == 1 {
+					return &types.ResourceNotFoundException{Message: aws.String("no such table")}
+				}
+			case "CreateTable":
+				return &types.ResourceInUseException{Message: aws.String("table exists")}
+			}
+			return nil
+		}
+		if err := ensureTable(context.Background(), db); err != nil {
+			t.Fatalf("ensureTable = %v, want ResourceInUse tolerated", err)
+		}
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		db := newFakeDB()
+		db.before = func(ctx context.Context, op string, input any) error {
+			return errors.New("access denied")
+		}
+		if err := ensureTable(context.Background(), db); err == nil || db.called("CreateTable") != 0 {
+			t.Fatalf("ensureTable = %v after %d CreateTable calls", err, db.called("CreateTable"))
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// maxPurgeDeletes caps how many mappings one bulk delete removes, so a bad
+	// filter can't wipe the table in a single call
+	maxPurgeDeletes      = 1000
+	maxBatchWriteRetries = 3 // Rounds spent resubmitting unprocessed deletes
+)
+
+// PurgeResponse is the body returned from a bulk delete
+type PurgeResponse struct {
+	Deleted int  `json:"deleted"`
+	More    bool `json:"more"` // More items matched than the cap; call again to continue
+}
+
+// purgeURLs handles DELETE /api/urls requests
+// It removes every mapping created before ?older_than (RFC3339) and/or
+// belonging to ?tenant, up to maxPurgeDeletes per call. Unlike a single
+// DELETE this is permanent; there is nothing left to restore.
+func purgeURLs(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var cutoff time.Time
+	if raw := request.QueryStringParameters["older_than"]; raw != "" {
+		var err error
+		if cutoff, err = time.Parse(time.RFC3339, raw); err != nil {
+			return errorResponse(400, "older_than must be an RFC3339 time"), nil
+		}
+	}
+	tenant := request.QueryStringParameters["tenant"]
+	if tenant != "" {
+		if err := validateCustomAlias(tenant); err != nil {
+			return errorResponse(400, "invalid tenant"), nil
+		}
+	}
+	if cutoff.IsZero() && tenant == "" {
+		return errorResponse(400, "older_than or tenant is required"), nil
+	}
+
+	// Collect matching keys, stopping once the cap is reached
+	var keys []map[string]types.AttributeValue
+	liveByTenant := map[string]int{} // Links still counting against a tenant quota
+	more := false
+	paginator := dynamodb.NewScanPaginator(ddbClient, &dynamodb.ScanInput{
+		TableName: &tableName,
+	})
+	for paginator.HasMorePages() && !more {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return errorResponse(500, "Error scanning DynamoDB"), err
+		}
+
+		var mappings []URLMapping
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &mappings); err != nil {
+			return errorResponse(500, "Error unmarshaling item"), err
+		}
+		for _, m := range mappings {
+			if !cutoff.IsZero() && !m.CreatedAt.Before(cutoff) {
+				continue
+			}
+			if tenant != "" && m.Tenant != tenant {
+				continue
+			}
+			if len(keys) == maxPurgeDeletes {
+				more = true
+				break
+			}
+			key, err := shortURLKey(m.ShortURL)
+			if err != nil {
+				return errorResponse(500, "Error creating key"), err
+			}
+			keys = append(keys, key)
+			if m.DeletedAt == 0 {
+				liveByTenant[m.Tenant]++
+			}
+		}
+	}
+
+	deleted := 0
+	for start := 0; start < len(keys); start += maxBatchSize {
+		chunk := keys[start:min(start+maxBatchSize, len(keys))]
+		writes := make([]types.WriteRequest, len(chunk))
+		for i, key := range chunk {
+			writes[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}}
+		}
+
+		// Resubmit anything DynamoDB hands back as unprocessed, then give up on it
+		for attempt := 0; len(writes) > 0 && attempt < maxBatchWriteRetries; attempt++ {
+			output, err := ddbClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{tableName: writes},
+			})
+			if err != nil {
+				loggerFrom(ctx).Error("Error deleting batch", slog.Int("deleted", deleted), slog.Any("error", err))
+				return errorResponse(500, "Error deleting from DynamoDB"), err
+			}
+			writes = output.UnprocessedItems[tableName]
+		}
+
+		deleted += len(chunk) - len(writes)
+		if len(writes) > 0 {
+			more = true
+		}
+	}
+
+	// Give quota back only when everything went; otherwise we can't tell which
+	// tenants' links survived, and a count that stays high is the safer error
+	if deleted == len(keys) {
+		for t, n := range liveByTenant {
+			if tenantQuotaEnabled(t) {
+				releaseQuota(ctx, tenantQuotaID(t), n)
+			}
+		}
+	}
+
+	loggerFrom(ctx).Info("Bulk delete finished",
+		slog.Int("deleted", deleted),
+		slog.String("older_than", request.QueryStringParameters["older_than"]),
+		slog.String("tenant", tenant),
+	)
+	return jsonResponse(200, PurgeResponse{Deleted: deleted, More: more})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPurgeURLs(t *testing.T) {
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	seedAges := func(t *testing.T, db *fakeDB) {
+		for i, at := range []time.Time{cutoff.AddDate(0, -2, 0), cutoff.Add(-time.Second), cutoff, cutoff.AddDate(0, 1, 0)} {
+			seedLink(t, db, URLMapping{ShortURL: fmt.Sprintf("code%03d", i), LongURL: "https://example.com", CreatedAt: at})
+		}
+		seedLink(t, db, URLMapping{ShortURL: "acme/old1234", LongURL: "https://example.com", CreatedAt: cutoff.AddDate(-1, 0, 0), Tenant: "acme"})
+	}
+
+	t.Run("older than", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedAges(t, db)
+		response := serve(t, newRequest("DELETE", "/api/urls?older_than="+cutoff.Format(time.RFC3339), ""))
+		var got PurgeResponse
+		decode(t, response, &got)
+		if response.StatusCode != 200 || got.Deleted != 3 || got.More {
+			t.Fatalf("purge = %d %+v, want 3 deleted", response.StatusCode, got)
+		}
+		var left []string
+		for _, item := range db.items("urls") {
+			left = append(left, scalar(item["short_url"]))
+		}
+		if strings.Join(left, ",") != "code002,code003" {
+			t.Fatalf("left = %v, want the links created at or after the cutoff", left)
+		}
+	})
+	t.Run("tenant", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedAges(t, db)
+		var got PurgeResponse
+		decode(t, serve(t, newRequest("DELETE", "/api/urls?tenant=acme", "")), &got)
+		if got.Deleted != 1 || db.mapping(t, "acme/old1234") != nil || len(db.items("urls")) != 4 {
+			t.Fatalf("purge = %+v, %d items left", got, len(db.items("urls")))
+		}
+	})
+	t.Run("no filter", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedAges(t, db)
+		if response := serve(t, newRequest("DELETE", "/api/urls", "")); response.StatusCode != 400 || len(db.items("urls")) != 5 {
+			t.Fatalf("unfiltered purge = %d with %d items left", response.StatusCode, len(db.items("urls")))
+		}
+	})
+	t.Run("needs a key", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedAges(t, db)
+		request := newRequest("DELETE", "/api/urls?tenant=acme", "")
+		delete(request.Headers, "x-api-key")
+		if response := serve(t, request); response.StatusCode != 401 || len(db.items("urls")) != 5 {
+			t.Fatalf("keyless purge = %d", response.StatusCode)
+		}
+	})
+}
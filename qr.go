@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/skip2/go-qrcode"
+)
+
+// qrCodeSize is the width and height in pixels of generated QR codes
+const qrCodeSize = 256
+
+// getQRCode handles GET /api/{shortURL}/qr requests
+// It returns a PNG QR code encoding the full short URL
+func getQRCode(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	shortURL := requestShortURL(request)
+
+	urlMapping, err := getMapping(ctx, shortURL)
+	if err != nil {
+		return errorResponse(500, "Error querying DynamoDB"), err
+	}
+	if urlMapping == nil {
+		return errorResponse(404, "URL not found"), nil
+	}
+
+	png, err := qrcode.Encode(fullShortURL(request, urlMapping.ShortURL), qrcode.Medium, qrCodeSize)
+	if err != nil {
+		return errorResponse(500, "Error generating QR code"), err
+	}
+
+	// API Gateway decodes base64 bodies back to binary for the client
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Headers:         map[string]string{"Content-Type": "image/png"},
+		Body:            base64.StdEncoding.EncodeToString(png),
+		IsBase64Encoded: true,
+	}, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"testing"
+)
+
+func TestQRCodeIsAPNG(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+
+	response := serve(t, newRequest("GET", "/api/abc1234/qr", ""))
+	if response.StatusCode != 200 || response.Headers["Content-Type"] != "image/png" || !response.IsBase64Encoded {
+		t.Fatalf("qr = %d %q base64=%v", response.StatusCode, response.Headers["Content-Type"], response.IsBase64Encoded)
+	}
+	raw, err := base64.StdEncoding.DecodeString(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("body is not a PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() == 0 || b.Dy() == 0 {
+		t.Fatalf("image is %dx%d", b.Dx(), b.Dy())
+	}
+
+	if response := serve(t, newRequest("GET", "/api/missing1/qr", "")); response.StatusCode != 404 {
+		t.Fatalf("unknown code = %d, want 404", response.StatusCode)
+	}
+}
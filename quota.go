@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Quotas are counters in quotaTable keyed by quota_id, taken from with a
+// conditional ADD like the rate limiter so concurrent creates can't overshoot
+var (
+	quotaTable = os.Getenv("QUOTA_TABLE") // Quotas are off when unset
+	// Custom aliases one API key may reserve; 0 means unlimited
+	maxAliasesPerKey = envInt("MAX_ALIASES_PER_KEY", 0)
+	// Live links one tenant may have; 0 means unlimited
+	maxLinksPerTenant = envInt("MAX_LINKS_PER_TENANT", 0)
+)
+
+// errQuotaExceeded is returned by takeQuota when the counter is at its limit
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaErrorResponse is the 403 body for a create over quota
+type QuotaErrorResponse struct {
+	Error string `json:"error"`
+	Used  int    `json:"used"`
+	Limit int    `json:"limit"`
+}
+
+// aliasQuotaID is the quota counter for the custom aliases principal has reserved
+func aliasQuotaID(principal string) string {
+	return "aliases#" + principal
+}
+
+// tenantQuotaID is the quota counter for the live links in tenant
+func tenantQuotaID(tenant string) string {
+	return "tenant#" + tenant
+}
+
+// tenantQuotaEnabled reports whether links in tenant count against a quota
+func tenantQuotaEnabled(tenant string) bool {
+	return tenant != "" && quotaTable != "" && maxLinksPerTenant > 0
+}
+
+// takeQuota adds n to the counter for id unless that would take it past limit.
+// Over the limit it returns errQuotaExceeded and the current count.
+func takeQuota(ctx context.Context, id string, limit, n int) (int, error) {
+	// With n > limit there's no room even in a fresh counter
+	condition := "attribute_not_exists(#used) OR #used <= :max"
+	if n > limit {
+		condition = "#used <= :max"
+	}
+
+	result, err := ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &quotaTable,
+		Key: map[string]types.AttributeValue{
+			"quota_id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("ADD #used :n"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#used": "used",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":n":   &types.AttributeValueMemberN{Value: strconv.Itoa(n)},
+			":max": &types.AttributeValueMemberN{Value: strconv.Itoa(limit - n)},
+		},
+		ReturnValues:                        types.ReturnValueUpdatedNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return quotaUsed(condErr.Item), errQuotaExceeded
+		}
+		return 0, err
+	}
+	return quotaUsed(result.Attributes), nil
+}
+
+// releaseQuota gives n back to the counter for id, e.g. when the create it
+// was taken for fails. Errors are logged; the count just stays high.
+func releaseQuota(ctx context.Context, id string, n int) {
+	if n <= 0 {
+		return
+	}
+	_, err := ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &quotaTable,
+		Key: map[string]types.AttributeValue{
+			"quota_id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("ADD #used :minus"),
+		ConditionExpression: aws.String("#used >= :n"),
+		ExpressionAttributeNames: map[string]string{
+			"#used": "used",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":minus": &types.AttributeValueMemberN{Value: strconv.Itoa(-n)},
+			":n":     &types.AttributeValueMemberN{Value: strconv.Itoa(n)},
+		},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &condErr) {
+		loggerFrom(ctx).Error("Error releasing quota", slog.String("quota_id", id), slog.Any("error", err))
+	}
+}
+
+// quotaUsed reads the used count from a quota item
+func quotaUsed(item map[string]types.AttributeValue) int {
+	if used, ok := item["used"].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.Atoi(used.Value)
+		return n
+	}
+	return 0
+}
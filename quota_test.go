@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAliasReservationLimit(t *testing.T) {
+	useFakeDB(t)
+	setVar(t, &quotaTable, "quota")
+	setVar(t, &maxAliasesPerKey, 2)
+	setVar(t, &apiKeys, []string{testAPIKey, "other-key"})
+
+	createLink(t, `{"long_url":"https://example.com","custom_alias":"first"}`)
+
+	// A taken alias hands its reservation back, so it doesn't use up the quota
+	if response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"first"}`)); response.StatusCode != 409 {
+		t.Fatalf("taken alias = %d, want 409", response.StatusCode)
+	}
+	createLink(t, `{"long_url":"https://example.com","custom_alias":"second"}`)
+
+	response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"third"}`))
+	var body QuotaErrorResponse
+	decode(t, response, &body)
+	if response.StatusCode != 403 || body.Used != 2 || body.Limit != 2 {
+		t.Fatalf("over the limit = %d %+v", response.StatusCode, body)
+	}
+
+	// Random codes are unlimited, and other keys have their own count
+	createLink(t, `{"long_url":"https://example.com/random"}`)
+	request := newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"third"}`)
+	request.Headers["x-api-key"] = "other-key"
+	if response := serve(t, request); response.StatusCode != 201 {
+		t.Fatalf("another key's alias = %d, want 201", response.StatusCode)
+	}
+}
+
+func TestTenantLinkLimit(t *testing.T) {
+	useFakeDB(t)
+	setVar(t, &quotaTable, "quota")
+	setVar(t, &maxLinksPerTenant, 2)
+
+	create := func(tenant, alias string) events.APIGatewayProxyResponse {
+		t.Helper()
+		request := newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"`+alias+`"}`)
+		request.Headers["x-tenant"] = tenant
+		return serve(t, request)
+	}
+
+	for _, alias := range []string{"one", "two"} {
+		if response := create("acme", alias); response.StatusCode != 201 {
+			t.Fatalf("create %s = %d %s", alias, response.StatusCode, response.Body)
+		}
+	}
+	response := create("acme", "three")
+	var body QuotaErrorResponse
+	decode(t, response, &body)
+	if response.StatusCode != 403 || body.Used != 2 || body.Limit != 2 {
+		t.Fatalf("over the cap = %d %+v", response.StatusCode, body)
+	}
+	if response := create("globex", "three"); response.StatusCode != 201 {
+		t.Fatalf("another tenant = %d, want 201", response.StatusCode)
+	}
+
+	// Deleting a link frees its slot
+	del := newRequest("DELETE", "/api/one", "")
+	del.Headers["x-tenant"] = "acme"
+	if response := serve(t, del); response.StatusCode != 204 {
+		t.Fatalf("delete = %d %s", response.StatusCode, response.Body)
+	}
+	if response := create("acme", "three"); response.StatusCode != 201 {
+		t.Fatalf("create after delete = %d %s", response.StatusCode, response.Body)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Rate limiting gives each client IP a token bucket that holds up to
+// rateLimitPerMinute tokens and refills continuously at that rate, so a
+// client can burst to the limit and then gets one request per refill
+// interval. Buckets live in rateLimitTable keyed by bucket_id. Each update
+// is conditional on the version it read, so concurrent Lambdas can't both
+// spend the same token. Point the table's TTL at expires_at to clean up
+// buckets that have refilled.
+var (
+	rateLimitTable     = os.Getenv("RATE_LIMIT_TABLE") // Rate limiting is off when unset
+	rateLimitPerMinute = envInt("RATE_LIMIT_PER_MINUTE", 60)
+)
+
+// rateLimitAttempts bounds how often a bucket update is retried after losing
+// a race; a client still contending after that is treated as over the limit
+const rateLimitAttempts = 3
+
+// errRateLimited is returned by takeRateLimitToken when the bucket is empty
+var errRateLimited = errors.New("rate limit exceeded")
+
+// rateLimitBucket is one client's token bucket in rateLimitTable
+type rateLimitBucket struct {
+	BucketID   string  `dynamodbav:"bucket_id"`
+	Tokens     float64 `dynamodbav:"tokens"`
+	RefilledAt int64   `dynamodbav:"refilled_at"` // Unix milliseconds when Tokens was computed
+	Version    int64   `dynamodbav:"version"`     // Bumped on every write for the conditional update
+	ExpiresAt  int64   `dynamodbav:"expires_at"`
+}
+
+// takeRateLimitToken spends one token from clientIP's bucket.
+// It returns errRateLimited and the seconds until a token is available when it is empty.
+func takeRateLimitToken(ctx context.Context, clientIP string, now time.Time) (int, error) {
+	if rateLimitTable == "" || clientIP == "" {
+		return 0, nil
+	}
+
+	capacity := float64(rateLimitPerMinute)
+	perMilli := capacity / float64(time.Minute.Milliseconds())
+	key := map[string]types.AttributeValue{
+		"bucket_id": &types.AttributeValueMemberS{Value: clientIP},
+	}
+
+	for attempt := 1; attempt <= rateLimitAttempts; attempt++ {
+		result, err := ddbClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      &rateLimitTable,
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		// A missing bucket is a full one
+		bucket := rateLimitBucket{BucketID: clientIP, Tokens: capacity, RefilledAt: now.UnixMilli()}
+		condition := "attribute_not_exists(bucket_id)"
+		values := map[string]types.AttributeValue{}
+		if result.Item != nil {
+			var stored rateLimitBucket
+			if err := attributevalue.UnmarshalMap(result.Item, &stored); err != nil {
+				return 0, err
+			}
+			// Another Lambda's clock may be ahead; never refill backwards
+			bucket.RefilledAt = max(bucket.RefilledAt, stored.RefilledAt)
+			bucket.Tokens = min(capacity, stored.Tokens+float64(bucket.RefilledAt-stored.RefilledAt)*perMilli)
+			bucket.Version = stored.Version
+			condition = "version = :version"
+			values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(stored.Version, 10)}
+		}
+
+		if bucket.Tokens < 1 {
+			return int(math.Ceil((1 - bucket.Tokens) / perMilli / 1000)), errRateLimited
+		}
+		bucket.Tokens--
+		bucket.Version++
+		// Once the bucket has refilled it is no different from a missing one
+		bucket.ExpiresAt = now.Add(2 * time.Minute).Unix()
+
+		item, err := attributevalue.MarshalMap(bucket)
+		if err != nil {
+			return 0, err
+		}
+		input := &dynamodb.PutItemInput{
+			TableName:           &rateLimitTable,
+			Item:                item,
+			ConditionExpression: &condition,
+		}
+		if len(values) > 0 {
+			input.ExpressionAttributeValues = values
+		}
+		_, err = ddbClient.PutItem(ctx, input)
+		if err == nil {
+			return 0, nil
+		}
+		var condErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &condErr) {
+			return 0, err
+		}
+	}
+	return 1, errRateLimited
+}
+
+// envInt reads a positive integer from the environment, falling back to def
+func envInt(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		baseLogger.Warn("Ignoring invalid integer setting", slog.String("key", key), slog.String("value", raw), slog.Int("default", def))
+		return def
+	}
+	return n
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRejectsOverLimit(t *testing.T) {
+	db := useFakeDB(t)
+	setVar(t, &rateLimitTable, "ratelimit")
+	setVar(t, &rateLimitPerMinute, 3)
+	now := time.Date(2024, 5, 1, 12, 0, 20, 0, time.UTC)
+
+	for i := 1; i <= 3; i++ {
+		if _, err := takeRateLimitToken(context.Background(), "198.51.100.1", now); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	// Three a minute refills one token every 20 seconds
+	retryAfter, err := takeRateLimitToken(context.Background(), "198.51.100.1", now)
+	if !errors.Is(err, errRateLimited) || retryAfter != 20 {
+		t.Fatalf("request 4 = %d, %v; want 20, errRateLimited", retryAfter, err)
+	}
+	if _, err := takeRateLimitToken(context.Background(), "198.51.100.2", now); err != nil {
+		t.Fatalf("another client was limited: %v", err)
+	}
+	if _, err := takeRateLimitToken(context.Background(), "198.51.100.1", now.Add(15*time.Second)); !errors.Is(err, errRateLimited) {
+		t.Fatalf("a partly refilled bucket = %v, want errRateLimited", err)
+	}
+	if _, err := takeRateLimitToken(context.Background(), "198.51.100.1", now.Add(20*time.Second)); err != nil {
+		t.Fatalf("the refilled token was refused: %v", err)
+	}
+
+	// Unlike a fixed window, the turn of the minute doesn't hand out a fresh burst
+	edge := time.Date(2024, 5, 1, 12, 0, 59, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		if _, err := takeRateLimitToken(context.Background(), "198.51.100.3", edge); err != nil {
+			t.Fatalf("burst request %d: %v", i, err)
+		}
+	}
+	if _, err := takeRateLimitToken(context.Background(), "198.51.100.3", edge.Add(2*time.Second)); !errors.Is(err, errRateLimited) {
+		t.Fatalf("request just after the minute = %v, want errRateLimited", err)
+	}
+
+	// A long idle spell refills the bucket to its capacity and no further
+	later := now.Add(time.Hour)
+	for i := 1; i <= 3; i++ {
+		if _, err := takeRateLimitToken(context.Background(), "198.51.100.1", later); err != nil {
+			t.Fatalf("request %d after idling: %v", i, err)
+		}
+	}
+	if _, err := takeRateLimitToken(context.Background(), "198.51.100.1", later); !errors.Is(err, errRateLimited) {
+		t.Fatalf("request 4 after idling = %v, want errRateLimited", err)
+	}
+
+	// Through the handler the extra create gets a 429 with Retry-After
+	setVar(t, &rateLimitPerMinute, 1)
+	createLink(t, `{"long_url":"https://example.com"}`)
+	response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com"}`))
+	if response.StatusCode != 429 || response.Headers["Retry-After"] == "" {
+		t.Fatalf("create over the limit = %d, Retry-After %q", response.StatusCode, response.Headers["Retry-After"])
+	}
+	if n := len(db.items("urls")); n != 1 {
+		t.Fatalf("%d links stored, want 1", n)
+	}
+}
+
+func TestRateLimitRetriesALostRace(t *testing.T) {
+	db := useFakeDB(t)
+	setVar(t, &rateLimitTable, "ratelimit")
+	setVar(t, &rateLimitPerMinute, 2)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := takeRateLimitToken(context.Background(), "198.51.100.1", now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another Lambda spends the last token between our read and our write
+	raced := false
+	db.before = func(ctx context.Context, op string, input any) error {
+		if op == "PutItem" && !raced {
+			raced = true
+			db.before = nil
+			if _, err := takeRateLimitToken(ctx, "198.51.100.1", now); err != nil {
+				t.Errorf("racing request: %v", err)
+			}
+		}
+		return nil
+	}
+	if _, err := takeRateLimitToken(context.Background(), "198.51.100.1", now); !errors.Is(err, errRateLimited) {
+		t.Fatalf("request after losing the race = %v, want errRateLimited", err)
+	}
+	if got := db.called("GetItem"); got != 4 {
+		t.Fatalf("%d reads, want the lost update to be re-read", got)
+	}
+}
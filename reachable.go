@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// reachableTimeout bounds the whole reachability check, redirects included
+const reachableTimeout = 3 * time.Second
+
+// reachableClient checks destinations before they are shortened
+// Like previewClient it follows at most three redirects and never connects
+// to a private address, so the reported status can't come from inside the VPC
+var reachableClient = &http.Client{
+	Timeout:   reachableTimeout,
+	Transport: publicOnlyTransport(),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// UnreachableResponse is the 422 body for a destination that failed the check
+type UnreachableResponse struct {
+	Error  string `json:"error"`
+	Status int    `json:"status,omitempty"` // Status the destination answered with; absent on timeouts
+}
+
+// checkReachable sends a HEAD request to longURL and returns the final status.
+// Servers that don't implement HEAD get a GET instead, whose body is never read.
+func checkReachable(ctx context.Context, longURL string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, reachableTimeout)
+	defer cancel()
+
+	status, err := probeStatus(ctx, http.MethodHead, longURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = probeStatus(ctx, http.MethodGet, longURL)
+	}
+	return status, err
+}
+
+// probeStatus issues one request with method and returns the response status
+func probeStatus(ctx context.Context, method, longURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, longURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	setTraceHeaders(ctx, req)
+	resp, err := reachableClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
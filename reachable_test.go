@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestCreateVerifiesReachability(t *testing.T) {
+	setVar(t, &allowPrivateHosts, true)
+	var methods []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusNotFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	setVar(t, &reachableClient, &http.Client{Transport: publicOnlyTransport(), CheckRedirect: reachableClient.CheckRedirect})
+
+	t.Run("200", func(t *testing.T) {
+		useFakeDB(t)
+		createLink(t, `{"long_url":"`+server.URL+`/ok","verify_reachable":true}`)
+		if len(methods) == 0 || methods[0] != http.MethodHead {
+			t.Fatalf("methods = %v, want a HEAD request", methods)
+		}
+	})
+	t.Run("404", func(t *testing.T) {
+		db := useFakeDB(t)
+		response := serve(t, newRequest("POST", "/", `{"long_url":"`+server.URL+`/gone","verify_reachable":true}`))
+		var got UnreachableResponse
+		decode(t, response, &got)
+		if response.StatusCode != 422 || got.Status != 404 || got.Error == "" {
+			t.Fatalf("create = %d %+v, want 422 reporting 404", response.StatusCode, got)
+		}
+		if db.called("PutItem") != 0 {
+			t.Fatal("an unreachable destination was stored")
+		}
+	})
+	t.Run("redirect loop", func(t *testing.T) {
+		db := useFakeDB(t)
+		mu.Lock()
+		methods = nil
+		mu.Unlock()
+		// The check stops after three hops; still being redirected then fails it
+		response := serve(t, newRequest("POST", "/", `{"long_url":"`+server.URL+`/loop","verify_reachable":true}`))
+		if len(methods) != 3 {
+			t.Fatalf("check made %d requests, want it to stop at 3", len(methods))
+		}
+		var got UnreachableResponse
+		decode(t, response, &got)
+		if response.StatusCode != 422 || got.Status != 302 {
+			t.Fatalf("create = %d %+v, want 422 reporting 302", response.StatusCode, got)
+		}
+		if db.called("PutItem") != 0 {
+			t.Fatal("a redirect loop was stored")
+		}
+	})
+	t.Run("private address", func(t *testing.T) {
+		setVar(t, &allowPrivateHosts, false)
+		setVar(t, &reachableClient, &http.Client{Transport: publicOnlyTransport()})
+		if _, err := checkReachable(context.Background(), server.URL+"/ok"); !errors.Is(err, errPrivateHost) {
+			t.Fatalf("check = %v, want errPrivateHost", err)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	maxDestinations      = 10   // Variants one short code may split across
+	maxDestinationWeight = 1000 // Upper bound on a single variant's weight
+	maxGeoDestinations   = 50   // Countries one short code may route separately
+	maxRedirectHeaders   = 10   // Custom headers one short code may send
+	maxHeaderNameBytes   = 64
+	maxHeaderValueBytes  = 512
+	maxFragmentBytes     = 256
+)
+
+// headerNamePattern matches an HTTP header field name (an RFC 9110 token)
+var headerNamePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// deniedRedirectHeaders can't be set per link, because they either carry the
+// redirect itself or would let a link creator tamper with the response
+var deniedRedirectHeaders = map[string]bool{
+	"location":          true,
+	"cache-control":     true,
+	"content-length":    true,
+	"content-type":      true,
+	"content-encoding":  true,
+	"transfer-encoding": true,
+	"connection":        true,
+	"set-cookie":        true,
+	"host":              true,
+}
+
+// isDeniedRedirectHeader reports whether name is denylisted, CORS headers included
+func isDeniedRedirectHeader(name string) bool {
+	name = strings.ToLower(name)
+	return deniedRedirectHeaders[name] || strings.HasPrefix(name, "access-control-")
+}
+
+// validateRedirectHeaders checks a create request's redirect_headers
+func validateRedirectHeaders(headers map[string]string) error {
+	if len(headers) > maxRedirectHeaders {
+		return fmt.Errorf("at most %d redirect_headers", maxRedirectHeaders)
+	}
+	for name, value := range headers {
+		if len(name) > maxHeaderNameBytes || !headerNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid redirect header name %q", name)
+		}
+		if isDeniedRedirectHeader(name) {
+			return fmt.Errorf("redirect header %q can't be overridden", name)
+		}
+		if len(value) > maxHeaderValueBytes || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for redirect header %q", name)
+		}
+	}
+	return nil
+}
+
+// customRedirectHeaders copies a mapping's redirect headers into a new map,
+// skipping denylisted names in case an item was written before the check
+func customRedirectHeaders(urlMapping *URLMapping) map[string]string {
+	headers := make(map[string]string, len(urlMapping.RedirectHeaders)+2)
+	for name, value := range urlMapping.RedirectHeaders {
+		if !isDeniedRedirectHeader(name) {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// viewerCountryHeader carries the visitor's ISO country code. CloudFront adds
+// it when the distribution forwards it to the API Gateway origin.
+const viewerCountryHeader = "CloudFront-Viewer-Country"
+
+// countryCodePattern matches an ISO 3166-1 alpha-2 country code
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// destinationFor picks the URL a redirect goes to. A device-specific URL
+// wins, then a rule for the visitor's country, then an A/B split, then
+// LongURL. split reports whether an A/B variant was drawn, so the click can
+// record it.
+func destinationFor(urlMapping *URLMapping, request events.APIGatewayProxyRequest) (destination string, split bool) {
+	switch deviceOf(headerValue(request, "User-Agent")) {
+	case deviceIOS:
+		if urlMapping.IOSURL != "" {
+			return urlMapping.IOSURL, false
+		}
+	case deviceAndroid:
+		if urlMapping.AndroidURL != "" {
+			return urlMapping.AndroidURL, false
+		}
+	}
+
+	country := strings.ToUpper(headerValue(request, viewerCountryHeader))
+	if geo, ok := urlMapping.GeoDestinations[country]; ok && country != "" {
+		return geo, false
+	}
+	if len(urlMapping.Destinations) > 0 {
+		return pickDestination(urlMapping), true
+	}
+	return urlMapping.LongURL, false
+}
+
+// WeightedDestination is one variant of an A/B split. A variant receives
+// Weight out of the total weight of all variants' traffic.
+type WeightedDestination struct {
+	URL    string `json:"url" dynamodbav:"url"`
+	Weight int    `json:"weight" dynamodbav:"weight"`
+}
+
+// pickDestination chooses where this redirect goes. Mappings without
+// variants always use LongURL; otherwise a variant is drawn by weight.
+func pickDestination(urlMapping *URLMapping) string {
+	total := 0
+	for _, destination := range urlMapping.Destinations {
+		total += max(destination.Weight, 0)
+	}
+	if total == 0 {
+		return urlMapping.LongURL
+	}
+
+	n := rand.IntN(total)
+	for _, destination := range urlMapping.Destinations {
+		if n < destination.Weight {
+			return destination.URL
+		}
+		n -= max(destination.Weight, 0)
+	}
+	return urlMapping.LongURL
+}
+
+// withUTMParams adds the mapping's stored UTM parameters to longURL.
+// Parameters already on the destination win, so a link's own campaign
+// tagging is never overwritten.
+func withUTMParams(longURL string, urlMapping *URLMapping) string {
+	utm := [][2]string{
+		{"utm_source", urlMapping.UTMSource},
+		{"utm_medium", urlMapping.UTMMedium},
+		{"utm_campaign", urlMapping.UTMCampaign},
+	}
+
+	parsed, err := url.Parse(longURL)
+	if err != nil {
+		return longURL
+	}
+	query := parsed.Query()
+	changed := false
+	for _, param := range utm {
+		if param[1] == "" || query.Has(param[0]) {
+			continue
+		}
+		query.Set(param[0], param[1])
+		changed = true
+	}
+	if !changed {
+		return longURL
+	}
+
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// Device families that can have their own destination
+const (
+	deviceOther = iota
+	deviceIOS
+	deviceAndroid
+)
+
+// deviceOf classifies a User-Agent header as iOS, Android or anything else.
+// iPadOS asks for desktop sites and reports itself as a Mac, so it lands in deviceOther.
+func deviceOf(userAgent string) int {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return deviceIOS
+	case strings.Contains(userAgent, "Android"):
+		return deviceAndroid
+	default:
+		return deviceOther
+	}
+}
+
+// withFragment sets longURL's #fragment. A stored fragment replaces one the
+// destination already has, since a URL can only carry one.
+func withFragment(longURL, fragment string) string {
+	if fragment == "" {
+		return longURL
+	}
+	parsed, err := url.Parse(longURL)
+	if err != nil {
+		return longURL
+	}
+	parsed.Fragment = fragment
+	parsed.RawFragment = ""
+	return parsed.String()
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedirectInjectsUTMParams(t *testing.T) {
+	tests := []struct {
+		name, longURL, want string
+	}{
+		{"bare url", "https://example.com/page", "https://example.com/page?utm_campaign=spring&utm_medium=email&utm_source=news"},
+		{"existing query", "https://example.com/page?id=7", "https://example.com/page?id=7&utm_campaign=spring&utm_medium=email&utm_source=news"},
+		{"conflicting utm", "https://example.com/page?utm_source=partner", "https://example.com/page?utm_campaign=spring&utm_medium=email&utm_source=partner"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t)
+			seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: tt.longURL,
+				UTMSource: "news", UTMMedium: "email", UTMCampaign: "spring"})
+			if got := serve(t, newRequest("GET", "/abc1234", "")).Headers["Location"]; got != tt.want {
+				t.Fatalf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	t.Run("no utm stored", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com/page?b=2&a=1"})
+		if got := serve(t, newRequest("GET", "/abc1234", "")).Headers["Location"]; got != "https://example.com/page?b=2&a=1" {
+			t.Fatalf("Location = %q, want the long URL untouched", got)
+		}
+	})
+}
+
+func TestWeightedSplit(t *testing.T) {
+	t.Run("50/50", func(t *testing.T) {
+		db := useFakeDB(t)
+		setVar(t, &clicksTable, "clicks")
+		created := createLink(t, `{"destinations":[{"url":"https://a.example","weight":50},{"url":"https://b.example","weight":50}]}`)
+
+		const requests = 2000
+		counts := map[string]int{}
+		for i := 0; i < requests; i++ {
+			counts[serve(t, newRequest("GET", "/"+created.ShortURL, "")).Headers["Location"]]++
+		}
+		for _, variant := range []string{"https://a.example", "https://b.example"} {
+			if n := counts[variant]; n < requests*4/10 || n > requests*6/10 {
+				t.Fatalf("counts = %v, want each variant near half", counts)
+			}
+		}
+
+		variants := map[string]int{}
+		for _, item := range db.items("clicks") {
+			variants[scalar(item["variant"])]++
+		}
+		if variants["https://a.example"] != counts["https://a.example"] || variants["https://b.example"] != counts["https://b.example"] {
+			t.Fatalf("recorded variants %v don't match the redirects %v", variants, counts)
+		}
+	})
+
+	t.Run("single destination", func(t *testing.T) {
+		useFakeDB(t)
+		created := createLink(t, `{"long_url":"https://only.example"}`)
+		if got := serve(t, newRequest("GET", "/"+created.ShortURL, "")).Headers["Location"]; got != "https://only.example" {
+			t.Fatalf("Location = %q", got)
+		}
+	})
+
+	for _, weights := range []string{`0,50`, `-1,50`, fmt.Sprintf("%d,1", maxDestinationWeight+1)} {
+		t.Run("weights "+weights, func(t *testing.T) {
+			db := useFakeDB(t)
+			w := strings.Split(weights, ",")
+			body := fmt.Sprintf(`{"destinations":[{"url":"https://a.example","weight":%s},{"url":"https://b.example","weight":%s}]}`, w[0], w[1])
+			if response := serve(t, newRequest("POST", "/", body)); response.StatusCode != 400 || db.called("PutItem") != 0 {
+				t.Fatalf("create = %d, want 400 with no write", response.StatusCode)
+			}
+		})
+	}
+}
+
+func TestGeoDestinations(t *testing.T) {
+	useFakeDB(t)
+	created := createLink(t, `{"long_url":"https://example.com","geo_destinations":{"DE":"https://example.de","fr":"https://example.fr"}}`)
+
+	tests := []struct {
+		name, country, want string
+	}{
+		{"matching country", "DE", "https://example.de"},
+		{"lowercase code stored", "FR", "https://example.fr"},
+		{"unmatched country", "US", "https://example.com"},
+		{"missing header", "", "https://example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := newRequest("GET", "/"+created.ShortURL, "")
+			if tt.country != "" {
+				request.Headers[viewerCountryHeader] = tt.country
+			}
+			if got := serve(t, request).Headers["Location"]; got != tt.want {
+				t.Fatalf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceDestinations(t *testing.T) {
+	useFakeDB(t)
+	created := createLink(t, `{"long_url":"https://example.com","ios_url":"https://apps.apple.com/app/id1","android_url":"https://play.google.com/store/apps/details?id=app"}`)
+
+	tests := []struct {
+		name, userAgent, want string
+	}{
+		{"iOS", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15", "https://apps.apple.com/app/id1"},
+		{"Android", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36", "https://play.google.com/store/apps/details?id=app"},
+		{"desktop", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36", "https://example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := newRequest("GET", "/"+created.ShortURL, "")
+			request.Headers["User-Agent"] = tt.userAgent
+			if got := serve(t, request).Headers["Location"]; got != tt.want {
+				t.Fatalf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectHeaders(t *testing.T) {
+	db := useFakeDB(t)
+	createLink(t, `{"long_url":"https://example.com","custom_alias":"hdrs","redirect_headers":{"Referrer-Policy":"no-referrer","X-Campaign":"spring"}}`)
+
+	response := serve(t, newRequest("GET", "/hdrs", ""))
+	if response.StatusCode != 302 || response.Headers["Location"] != "https://example.com" {
+		t.Fatalf("redirect = %d %q", response.StatusCode, response.Headers["Location"])
+	}
+	if response.Headers["Referrer-Policy"] != "no-referrer" || response.Headers["X-Campaign"] != "spring" {
+		t.Fatalf("custom headers missing: %v", response.Headers)
+	}
+
+	t.Run("denylisted names are refused", func(t *testing.T) {
+		for _, name := range []string{"Location", "content-length", "Set-Cookie", "Access-Control-Allow-Origin"} {
+			body := `{"long_url":"https://example.com","redirect_headers":{"` + name + `":"x"}}`
+			if response := serve(t, newRequest("POST", "/", body)); response.StatusCode != 400 {
+				t.Errorf("%s = %d, want 400", name, response.StatusCode)
+			}
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		headers := map[string]string{}
+		for i := 0; i <= maxRedirectHeaders; i++ {
+			headers[fmt.Sprintf("X-H%d", i)] = "v"
+		}
+		tooMany, _ := json.Marshal(map[string]any{"long_url": "https://example.com", "redirect_headers": headers})
+		if response := serve(t, newRequest("POST", "/", string(tooMany))); response.StatusCode != 400 {
+			t.Errorf("%d headers = %d, want 400", len(headers), response.StatusCode)
+		}
+		tooLong, _ := json.Marshal(map[string]any{"long_url": "https://example.com", "redirect_headers": map[string]string{"X-Big": strings.Repeat("v", maxHeaderValueBytes+1)}})
+		if response := serve(t, newRequest("POST", "/", string(tooLong))); response.StatusCode != 400 {
+			t.Errorf("oversized value = %d, want 400", response.StatusCode)
+		}
+	})
+
+	t.Run("stored denylisted headers are skipped", func(t *testing.T) {
+		seedLink(t, db, URLMapping{ShortURL: "oldhdrs", LongURL: "https://example.com/real", RedirectHeaders: map[string]string{"Location": "https://evil.example", "X-Ok": "1"}})
+		response := serve(t, newRequest("GET", "/oldhdrs", ""))
+		if response.Headers["Location"] != "https://example.com/real" || response.Headers["X-Ok"] != "1" {
+			t.Fatalf("headers = %v", response.Headers)
+		}
+	})
+}
+
+func TestRedirectAppendsFragment(t *testing.T) {
+	tests := []struct {
+		name     string
+		longURL  string
+		fragment string
+		location string
+	}{
+		{"no fragment stored", "https://example.com/docs#intro", "", "https://example.com/docs#intro"},
+		{"appended", "https://example.com/docs?v=2", "#install", "https://example.com/docs?v=2#install"},
+		{"replaces an existing one", "https://example.com/docs#intro", "setup", "https://example.com/docs#setup"},
+		{"escaped", "https://example.com/docs", "step 2", "https://example.com/docs#step%202"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeDB(t)
+			body, _ := json.Marshal(map[string]string{"long_url": tt.longURL, "fragment": tt.fragment})
+			created := createLink(t, string(body))
+
+			if got := serve(t, newRequest("GET", "/"+created.ShortURL, "")).Headers["Location"]; got != tt.location {
+				t.Fatalf("Location = %q, want %q", got, tt.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// What happens to the old code after a regenerate
+const (
+	oldCodeKeep     = "keep"     // Leave it working as before
+	oldCodeDelete   = "delete"   // Soft-delete it, as DELETE would
+	oldCodeRedirect = "redirect" // Point it at the new code until the grace period ends
+)
+
+// regenerateGracePeriod is how long a replaced code keeps forwarding to its successor
+var regenerateGracePeriod = time.Duration(envInt("REGENERATE_GRACE_SECONDS", 7*24*60*60)) * time.Second
+
+// RegenerateRequest represents the optional JSON body for regenerate requests
+type RegenerateRequest struct {
+	OldCode string `json:"old_code,omitempty"` // keep (default), delete or redirect
+}
+
+// regenerateShortURL handles POST /api/{shortURL}/regenerate requests
+// It copies the mapping to a fresh random code and then applies the
+// requested policy to the old one
+func regenerateShortURL(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	shortURL := requestShortURL(request)
+	if !validMappingKey(shortURL) {
+		return errorResponse(400, "invalid short url"), nil
+	}
+
+	regenReq := RegenerateRequest{OldCode: oldCodeKeep}
+	if strings.TrimSpace(request.Body) != "" {
+		if err := json.Unmarshal([]byte(request.Body), &regenReq); err != nil {
+			return errorResponse(400, "Invalid request body"), nil
+		}
+	}
+	switch regenReq.OldCode {
+	case "":
+		regenReq.OldCode = oldCodeKeep
+	case oldCodeKeep, oldCodeDelete, oldCodeRedirect:
+	default:
+		return errorResponse(400, "old_code must be keep, delete or redirect"), nil
+	}
+
+	old, err := getMapping(ctx, shortURL)
+	if err != nil {
+		return errorResponse(500, "Error querying DynamoDB"), err
+	}
+	if old == nil || old.DeletedAt != 0 {
+		return errorResponse(404, "URL not found"), nil
+	}
+
+	// Only whoever created a link may rotate it; links from before
+	// created_by was recorded are open to any key holder
+	if old.CreatedBy != "" && old.CreatedBy != "anonymous" && old.CreatedBy != requestPrincipal(request) {
+		return errorResponse(403, "only the creator of a link can regenerate it"), nil
+	}
+
+	// The new code is one more live link until the old one is retired
+	created := false
+	if tenantQuotaEnabled(old.Tenant) {
+		used, err := takeQuota(ctx, tenantQuotaID(old.Tenant), maxLinksPerTenant, 1)
+		if errors.Is(err, errQuotaExceeded) {
+			return jsonResponse(403, QuotaErrorResponse{Error: "tenant link limit reached", Used: used, Limit: maxLinksPerTenant})
+		}
+		if err != nil {
+			return errorResponse(500, "Error updating quota"), err
+		}
+		defer func() {
+			if !created {
+				releaseQuota(ctx, tenantQuotaID(old.Tenant), 1)
+			}
+		}()
+	}
+
+	fresh := *old
+	fresh.CreatedAt = time.Now()
+	fresh.AccessCount = 0
+	fresh.LastAccessedAt = nil
+
+	for attempt := 1; ; attempt++ {
+		fresh.setKey(mappingKey(old.Tenant, generateShortCode(shortCodeLength)))
+
+		item, err := attributevalue.MarshalMap(fresh)
+		if err != nil {
+			return errorResponse(500, "Error marshaling item"), err
+		}
+
+		_, err = ddbClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           &tableName,
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(short_url)"),
+		})
+		if err == nil {
+			break
+		}
+
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			if attempt < maxCreateAttempts {
+				continue
+			}
+			loggerFrom(ctx).Error("Could not find a free short code", slog.Int("attempts", attempt))
+			return errorResponse(500, "Could not generate a unique short code"), nil
+		}
+		return errorResponse(500, "Error saving to DynamoDB"), err
+	}
+
+	created = true
+	fresh.ShortURLFull = fullShortURL(request, fresh.ShortURL)
+	if err := retireOldCode(ctx, old, fresh.ShortURLFull, regenReq.OldCode); err != nil {
+		// The new code already exists; the caller can retry the DELETE by hand
+		return errorResponse(500, "Error updating the old short url"), err
+	}
+
+	loggerFrom(ctx).Info("Short URL regenerated",
+		slog.String("short_code", old.ShortURL),
+		slog.String("new_short_code", fresh.ShortURL),
+		slog.String("old_code", regenReq.OldCode),
+	)
+	return jsonResponse(201, fresh)
+}
+
+// retireOldCode applies a regenerate's old_code policy to the replaced mapping
+func retireOldCode(ctx context.Context, old *URLMapping, newShortURL, policy string) error {
+	if policy == oldCodeKeep {
+		return nil
+	}
+
+	key, err := shortURLKey(old.ShortURL)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:           &tableName,
+		Key:                 key,
+		ConditionExpression: aws.String("attribute_exists(short_url) AND attribute_not_exists(deleted_at)"),
+	}
+	switch policy {
+	case oldCodeDelete:
+		input.UpdateExpression = aws.String("SET deleted_at = :now")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		}
+	case oldCodeRedirect:
+		// Send every visitor to the new code with an uncached 302 until the
+		// grace period ends, dropping rules that would route them elsewhere
+		expiresAt := now.Add(regenerateGracePeriod).Unix()
+		if old.ExpiresAt != 0 && old.ExpiresAt < expiresAt {
+			expiresAt = old.ExpiresAt
+		}
+		input.UpdateExpression = aws.String("SET long_url = :u, redirect_code = :code, expires_at = :exp " +
+			"REMOVE destinations, geo_destinations, ios_url, android_url, max_clicks, utm_source, utm_medium, utm_campaign")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":u":    &types.AttributeValueMemberS{Value: newShortURL},
+			":code": &types.AttributeValueMemberN{Value: "302"},
+			":exp":  &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)},
+		}
+	}
+
+	_, err = ddbClient.UpdateItem(ctx, input)
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		// Deleted in the meantime, which is as retired as it gets
+		return nil
+	}
+	if err == nil && policy == oldCodeDelete && tenantQuotaEnabled(old.Tenant) {
+		releaseQuota(ctx, tenantQuotaID(old.Tenant), 1)
+	}
+	return err
+}
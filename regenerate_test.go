@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRegenerateShortURL(t *testing.T) {
+	tests := []struct {
+		policy string
+		status int // Old code's response afterwards
+	}{
+		{oldCodeKeep, 302},
+		{oldCodeDelete, 410},
+		{oldCodeRedirect, 302},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			db := useFakeDB(t)
+			created := createLink(t, `{"long_url":"https://example.com/dest"}`)
+
+			response := serve(t, newRequest("POST", "/api/"+created.ShortURL+"/regenerate", `{"old_code":"`+tt.policy+`"}`))
+			var fresh URLMapping
+			decode(t, response, &fresh)
+			if response.StatusCode != 201 || fresh.ShortURL == created.ShortURL || fresh.AccessCount != 0 {
+				t.Fatalf("regenerate = %d %+v", response.StatusCode, fresh)
+			}
+			if got := serve(t, newRequest("GET", "/"+fresh.ShortURL, "")).Headers["Location"]; got != "https://example.com/dest" {
+				t.Fatalf("new code redirects to %q", got)
+			}
+
+			old := serve(t, newRequest("GET", "/"+created.ShortURL, ""))
+			if old.StatusCode != tt.status {
+				t.Fatalf("old code = %d, want %d", old.StatusCode, tt.status)
+			}
+			if tt.policy == oldCodeRedirect {
+				if old.Headers["Location"] != fresh.ShortURLFull {
+					t.Fatalf("old code redirects to %q, want %q", old.Headers["Location"], fresh.ShortURLFull)
+				}
+				if stored := db.mapping(t, created.ShortURL); stored.ExpiresAt == 0 {
+					t.Fatal("forwarding code has no expiry")
+				}
+			}
+		})
+	}
+
+	t.Run("not the creator", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com", CreatedBy: "someone-else"})
+		if response := serve(t, newRequest("POST", "/api/abc1234/regenerate", "")); response.StatusCode != 403 {
+			t.Fatalf("status = %d, want 403", response.StatusCode)
+		}
+	})
+	t.Run("unknown policy", func(t *testing.T) {
+		db := useFakeDB(t)
+		seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+		if response := serve(t, newRequest("POST", "/api/abc1234/regenerate", `{"old_code":"archive"}`)); response.StatusCode != 400 {
+			t.Fatalf("status = %d, want 400", response.StatusCode)
+		}
+	})
+}
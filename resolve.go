@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	maxResolveCodes    = 100 // BatchGetItem accepts at most 100 keys per call
+	maxBatchGetRetries = 5   // Rounds spent re-reading unprocessed keys
+)
+
+// ResolveRequest represents the expected JSON structure for bulk resolves
+type ResolveRequest struct {
+	Codes []string `json:"codes"`
+}
+
+// ResolveResponse maps each requested code to its mapping; codes that don't
+// exist are listed in Missing instead
+type ResolveResponse struct {
+	URLs    map[string]URLMapping `json:"urls"`
+	Missing []string              `json:"missing"`
+}
+
+// resolveURLs handles POST /api/urls/resolve requests
+// It fetches up to maxResolveCodes mappings in one BatchGetItem.
+// Codes are resolved within the request's tenant, like single lookups.
+func resolveURLs(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err := requireJSONBody(request); err != nil {
+		return errorResponse(415, err.Error()), nil
+	}
+
+	var resolveReq ResolveRequest
+	if err := json.Unmarshal([]byte(request.Body), &resolveReq); err != nil {
+		return errorResponse(400, "Invalid request body"), nil
+	}
+	if len(resolveReq.Codes) == 0 {
+		return errorResponse(400, "codes is required"), nil
+	}
+	if len(resolveReq.Codes) > maxResolveCodes {
+		return errorResponse(400, fmt.Sprintf("at most %d codes per request", maxResolveCodes)), nil
+	}
+
+	resolved := ResolveResponse{URLs: map[string]URLMapping{}, Missing: []string{}}
+	tenant := requestTenant(request)
+	codes := map[string]string{} // storage key -> code as requested
+	var keys []map[string]types.AttributeValue
+	for _, code := range resolveReq.Codes {
+		shortURL := mappingKey(tenant, canonicalCode(code))
+		if _, seen := codes[shortURL]; seen {
+			continue
+		}
+		codes[shortURL] = code
+		// Codes that could never have been stored don't need a read to rule out
+		if !validMappingKey(shortURL) {
+			continue
+		}
+		key, err := shortURLKey(shortURL)
+		if err != nil {
+			return errorResponse(500, "Error creating key"), err
+		}
+		keys = append(keys, key)
+	}
+
+	mappings, err := batchGetMappings(ctx, keys)
+	if err != nil {
+		return errorResponse(500, "Error querying DynamoDB"), err
+	}
+	for shortURL, code := range codes {
+		m, ok := mappings[shortURL]
+		if !ok {
+			resolved.Missing = append(resolved.Missing, code)
+			continue
+		}
+		m.ShortURLFull = fullShortURL(request, m.ShortURL)
+		resolved.URLs[code] = m
+	}
+
+	return jsonResponse(200, resolved)
+}
+
+// batchGetMappings reads the mappings for keys, keyed by short_url.
+// DynamoDB may hand back some keys unprocessed when it throttles; those are
+// read again for up to maxBatchGetRetries rounds before giving up, backing
+// off between rounds the way retryThrottled does.
+func batchGetMappings(ctx context.Context, keys []map[string]types.AttributeValue) (map[string]URLMapping, error) {
+	mappings := make(map[string]URLMapping, len(keys))
+	delay := retryBaseDelay
+	for attempt := 0; len(keys) > 0; attempt++ {
+		if attempt > maxBatchGetRetries {
+			return nil, errors.New("keys still unprocessed after retries")
+		}
+		if attempt > 0 {
+			select {
+			case <-time.After(rand.N(delay) + 1):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			delay = min(delay*2, retryMaxDelay)
+		}
+		output, err := ddbClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				tableName: {Keys: keys, ConsistentRead: aws.Bool(consistentReads)},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var page []URLMapping
+		if err := attributevalue.UnmarshalListOfMaps(output.Responses[tableName], &page); err != nil {
+			return nil, err
+		}
+		for _, m := range page {
+			mappings[m.ShortURL] = m
+		}
+		keys = output.UnprocessedKeys[tableName].Keys
+	}
+	return mappings, nil
+}
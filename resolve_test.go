@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// throttledBatchGets is a fakeDB whose BatchGetItem leaves all but the first
+// key of each call unprocessed, the way DynamoDB does when it throttles
+type throttledBatchGets struct {
+	*fakeDB
+}
+
+func (f throttledBatchGets) BatchGetItem(ctx context.Context, in *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	out := &dynamodb.BatchGetItemOutput{UnprocessedKeys: map[string]types.KeysAndAttributes{}}
+	first := map[string]types.KeysAndAttributes{}
+	for table, ka := range in.RequestItems {
+		first[table] = types.KeysAndAttributes{Keys: ka.Keys[:1]}
+		if len(ka.Keys) > 1 {
+			out.UnprocessedKeys[table] = types.KeysAndAttributes{Keys: ka.Keys[1:]}
+		}
+	}
+	page, err := f.fakeDB.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: first}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	out.Responses = page.Responses
+	return out, nil
+}
+
+func TestResolveURLs(t *testing.T) {
+	resolve := func(t *testing.T, codes ...string) (int, ResolveResponse) {
+		t.Helper()
+		body, _ := json.Marshal(ResolveRequest{Codes: codes})
+		response := serve(t, newRequest("POST", "/api/urls/resolve", string(body)))
+		var resolved ResolveResponse
+		if response.StatusCode == 200 {
+			decode(t, response, &resolved)
+		}
+		return response.StatusCode, resolved
+	}
+
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "aaa1111", LongURL: "https://a.example"})
+	seedLink(t, db, URLMapping{ShortURL: "bbb2222", LongURL: "https://b.example"})
+
+	t.Run("all present", func(t *testing.T) {
+		status, resolved := resolve(t, "aaa1111", "bbb2222")
+		if status != 200 || len(resolved.URLs) != 2 || resolved.URLs["bbb2222"].LongURL != "https://b.example" || len(resolved.Missing) != 0 {
+			t.Fatalf("resolve = %d %+v", status, resolved)
+		}
+		if resolved.URLs["aaa1111"].ShortURLFull != "https://sho.rt/aaa1111" {
+			t.Fatalf("short_url_full = %q", resolved.URLs["aaa1111"].ShortURLFull)
+		}
+	})
+	t.Run("some missing", func(t *testing.T) {
+		status, resolved := resolve(t, "aaa1111", "zzz9999", "bad code!")
+		sort.Strings(resolved.Missing)
+		if status != 200 || len(resolved.URLs) != 1 || strings.Join(resolved.Missing, ",") != "bad code!,zzz9999" {
+			t.Fatalf("resolve = %d %+v", status, resolved)
+		}
+	})
+	t.Run("over the limit", func(t *testing.T) {
+		codes := make([]string, maxResolveCodes+1)
+		for i := range codes {
+			codes[i] = fmt.Sprintf("code%03d", i)
+		}
+		if status, _ := resolve(t, codes...); status != 400 {
+			t.Fatalf("%d codes = %d, want 400", len(codes), status)
+		}
+	})
+	t.Run("unprocessed keys are read again", func(t *testing.T) {
+		setVar[DynamoDBAPI](t, &ddbClient, throttledBatchGets{db})
+		calls := db.called("BatchGetItem")
+		status, resolved := resolve(t, "aaa1111", "bbb2222", "zzz9999")
+		if status != 200 || len(resolved.URLs) != 2 || len(resolved.Missing) != 1 {
+			t.Fatalf("resolve = %d %+v", status, resolved)
+		}
+		if got := db.called("BatchGetItem") - calls; got != 3 {
+			t.Fatalf("BatchGetItem calls = %d, want one per key", got)
+		}
+	})
+	t.Run("the backoff stops when the context ends", func(t *testing.T) {
+		setVar[DynamoDBAPI](t, &ddbClient, throttledBatchGets{db})
+		calls := db.called("BatchGetItem")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		keys := []map[string]types.AttributeValue{
+			{"short_url": &types.AttributeValueMemberS{Value: "aaa1111"}},
+			{"short_url": &types.AttributeValueMemberS{Value: "bbb2222"}},
+		}
+		if _, err := batchGetMappings(ctx, keys); !errors.Is(err, context.Canceled) {
+			t.Fatalf("batchGetMappings = %v, want context.Canceled", err)
+		}
+		if got := db.called("BatchGetItem") - calls; got != 1 {
+			t.Fatalf("BatchGetItem calls = %d, want no retry after cancel", got)
+		}
+	})
+}
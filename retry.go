@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	retryBaseDelay = 50 * time.Millisecond // First backoff before jitter
+	retryMaxDelay  = time.Second           // Backoff never grows past this
+)
+
+// dynamoDBMaxAttempts caps how many times a throttled write is tried in total
+var dynamoDBMaxAttempts = envInt("DYNAMODB_MAX_ATTEMPTS", 4)
+
+// retryableErrorCodes are DynamoDB errors worth retrying after a pause.
+// Validation and conditional check failures are deliberately absent.
+var retryableErrorCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+	"InternalServerError":                    true,
+	"ServiceUnavailable":                     true,
+}
+
+// retryClient retries throttled PutItem and UpdateItem calls with exponential
+// backoff and full jitter; every other call passes straight through and
+// keeps the SDK's own retries. The SDK retryer is turned off for the calls
+// retried here, so an attempt here is one request rather than three.
+type retryClient struct {
+	DynamoDBAPI
+	maxAttempts int
+}
+
+// withRetry returns client with throttled writes retried up to maxAttempts times
+func withRetry(client DynamoDBAPI, maxAttempts int) DynamoDBAPI {
+	return &retryClient{DynamoDBAPI: client, maxAttempts: maxAttempts}
+}
+
+func (c *retryClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	var out *dynamodb.PutItemOutput
+	err := retryThrottled(ctx, c.maxAttempts, func() error {
+		var err error
+		out, err = c.DynamoDBAPI.PutItem(ctx, params, append(optFns, withoutSDKRetries)...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	var out *dynamodb.UpdateItemOutput
+	err := retryThrottled(ctx, c.maxAttempts, func() error {
+		var err error
+		out, err = c.DynamoDBAPI.UpdateItem(ctx, params, append(optFns, withoutSDKRetries)...)
+		return err
+	})
+	return out, err
+}
+
+// withoutSDKRetries disables the SDK's retryer for one call
+func withoutSDKRetries(o *dynamodb.Options) {
+	o.Retryer = aws.NopRetryer{}
+}
+
+// retryThrottled runs op until it succeeds, fails with a non-retryable error,
+// runs out of attempts or ctx is done
+func retryThrottled(ctx context.Context, maxAttempts int, op func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= maxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		// Full jitter keeps a burst of throttled Lambdas from retrying in lockstep
+		select {
+		case <-time.After(rand.N(delay) + 1):
+		case <-ctx.Done():
+			return err
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// isRetryable reports whether err is a throttling or transient DynamoDB error
+func isRetryable(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return retryableErrorCodes[apiErr.ErrorCode()]
+	}
+	return false
+}
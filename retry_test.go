@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestRetryClientBacksOffOnThrottling(t *testing.T) {
+	// failPuts makes PutItem fail with each error in turn, then succeed
+	failPuts := func(db *fakeDB, errs ...error) {
+		db.before = func(ctx context.Context, op string, input any) error {
+			if op != "PutItem" || len(errs) == 0 {
+				return nil
+			}
+			err := errs[0]
+			errs = errs[1:]
+			return err
+		}
+	}
+	put := &dynamodb.PutItemInput{TableName: aws.String("urls"), Item: map[string]types.AttributeValue{
+		"short_url": &types.AttributeValueMemberS{Value: "abc1234"},
+	}}
+
+	t.Run("throttled twice", func(t *testing.T) {
+		db := newFakeDB()
+		throttled := &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+		failPuts(db, throttled, throttled)
+		if _, err := withRetry(db, 4).PutItem(context.Background(), put); err != nil {
+			t.Fatalf("PutItem = %v, want success after retries", err)
+		}
+		if db.called("PutItem") != 3 {
+			t.Fatalf("%d attempts, want 3", db.called("PutItem"))
+		}
+	})
+	t.Run("out of attempts", func(t *testing.T) {
+		db := newFakeDB()
+		throttled := &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+		failPuts(db, throttled, throttled, throttled)
+		if _, err := withRetry(db, 2).PutItem(context.Background(), put); !errors.Is(err, throttled) {
+			t.Fatalf("PutItem = %v, want the throttling error", err)
+		}
+		if db.called("PutItem") != 2 {
+			t.Fatalf("%d attempts, want 2", db.called("PutItem"))
+		}
+	})
+	t.Run("validation error fails fast", func(t *testing.T) {
+		db := newFakeDB()
+		invalid := &smithy.GenericAPIError{Code: "ValidationException", Message: "bad item"}
+		failPuts(db, invalid)
+		if _, err := withRetry(db, 4).PutItem(context.Background(), put); !errors.Is(err, invalid) {
+			t.Fatalf("PutItem = %v, want the validation error", err)
+		}
+		if db.called("PutItem") != 1 {
+			t.Fatalf("%d attempts, want 1", db.called("PutItem"))
+		}
+	})
+	t.Run("conditional failure fails fast", func(t *testing.T) {
+		db := newFakeDB()
+		db.put("urls", put.Item)
+		conditional := *put
+		conditional.ConditionExpression = aws.String("attribute_not_exists(short_url)")
+		if _, err := withRetry(db, 4).PutItem(context.Background(), &conditional); err == nil || db.called("PutItem") != 1 {
+			t.Fatalf("PutItem = %v after %d attempts, want one failed attempt", err, db.called("PutItem"))
+		}
+	})
+	t.Run("sdk retries are off", func(t *testing.T) {
+		var o dynamodb.Options
+		withoutSDKRetries(&o)
+		if _, ok := o.Retryer.(aws.NopRetryer); !ok {
+			t.Fatalf("retryer = %T, want aws.NopRetryer", o.Retryer)
+		}
+	})
+}
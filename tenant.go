@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Tenants namespace short codes so two teams can both own /xyz123. A tenant's
+// links are stored under the key "tenant/code", which is also the path they
+// are served from, e.g. /acme/xyz123. Links without a tenant keep a bare code.
+
+// requestTenant returns the tenant a request is scoped to, taken from the
+// {tenant} path parameter or the x-tenant header
+func requestTenant(request events.APIGatewayProxyRequest) string {
+	if tenant := request.PathParameters["tenant"]; tenant != "" {
+		return tenant
+	}
+	return headerValue(request, "x-tenant")
+}
+
+// requestShortURL returns the storage key of the short URL a request addresses
+func requestShortURL(request events.APIGatewayProxyRequest) string {
+	return mappingKey(requestTenant(request), canonicalCode(request.PathParameters["shortURL"]))
+}
+
+// mappingKey combines a tenant and a short code into the table's short_url key
+func mappingKey(tenant, code string) string {
+	if tenant == "" || code == "" {
+		return code
+	}
+	return tenant + "/" + code
+}
+
+// validMappingKey reports whether key is a well-formed code or tenant/code pair
+func validMappingKey(key string) bool {
+	tenant, code, scoped := strings.Cut(key, "/")
+	if !scoped {
+		return shortCodePattern.MatchString(key)
+	}
+	return shortCodePattern.MatchString(tenant) && shortCodePattern.MatchString(code)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSameCodeUnderTwoTenants(t *testing.T) {
+	db := useFakeDB(t)
+	for _, tenant := range []string{"acme", "globex"} {
+		request := newRequest("POST", "/", `{"long_url":"https://`+tenant+`.example","custom_alias":"xyz123"}`)
+		request.Headers["x-tenant"] = tenant
+		if response := serve(t, request); response.StatusCode != 201 {
+			t.Fatalf("create for %s = %d %s", tenant, response.StatusCode, response.Body)
+		}
+	}
+	if db.mapping(t, "acme/xyz123") == nil || db.mapping(t, "globex/xyz123") == nil {
+		t.Fatal("tenant codes were not stored under tenant/code keys")
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		response := serve(t, tenantRequest("GET", tenant, "xyz123"))
+		if want := "https://" + tenant + ".example"; response.StatusCode != 302 || response.Headers["Location"] != want {
+			t.Fatalf("/%s/xyz123 = %d %q, want %s", tenant, response.StatusCode, response.Headers["Location"], want)
+		}
+	}
+	if response := serve(t, newRequest("GET", "/xyz123", "")); response.StatusCode != 404 {
+		t.Fatalf("unscoped /xyz123 = %d, want 404", response.StatusCode)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// timestampKeys are JSON fields holding times that don't end in _at
+var timestampKeys = map[string]bool{
+	"bucket": true,
+	"from":   true,
+	"to":     true,
+}
+
+// validTimeFormat reports whether ?time_format is one this API understands
+func validTimeFormat(format string) bool {
+	return format == "" || format == "rfc3339" || format == "epoch"
+}
+
+// withTimeFormat rewrites RFC3339 timestamps in a JSON response as Unix
+// seconds when the request asked for ?time_format=epoch. It works on the
+// encoded body so every endpoint gets it without its own response types.
+func withTimeFormat(request events.APIGatewayProxyRequest, response events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	if request.QueryStringParameters["time_format"] != "epoch" ||
+		!strings.HasPrefix(response.Headers["Content-Type"], "application/json") {
+		return response
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(response.Body))
+	decoder.UseNumber() // Keep counts and IDs exactly as they were
+	var body any
+	if err := decoder.Decode(&body); err != nil {
+		return response
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(epochTimes(body)); err != nil {
+		return response
+	}
+	response.Body = strings.TrimSuffix(buf.String(), "\n")
+	return response
+}
+
+// epochTimes walks a decoded JSON value, converting timestamp fields
+func epochTimes(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if s, ok := field.(string); ok && (strings.HasSuffix(key, "_at") || timestampKeys[key]) {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					v[key] = t.Unix()
+				}
+				continue
+			}
+			v[key] = epochTimes(field)
+		}
+	case []any:
+		for i := range v {
+			v[i] = epochTimes(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeFormat(t *testing.T) {
+	db := useFakeDB(t)
+	createdAt := time.Date(2026, 5, 4, 12, 30, 0, 0, time.UTC)
+	seedLink(t, db, URLMapping{ShortURL: "times01", LongURL: "https://example.com/?a=1&b=2", CreatedAt: createdAt, AccessCount: 12})
+
+	var rfc map[string]any
+	decode(t, serve(t, newRequest("GET", "/api/times01", "")), &rfc)
+	if rfc["created_at"] != "2026-05-04T12:30:00Z" {
+		t.Fatalf("default created_at = %#v", rfc["created_at"])
+	}
+
+	response := serve(t, newRequest("GET", "/api/times01?time_format=epoch", ""))
+	var epoch map[string]any
+	decode(t, response, &epoch)
+	if epoch["created_at"] != float64(createdAt.Unix()) {
+		t.Fatalf("epoch created_at = %#v, want %d", epoch["created_at"], createdAt.Unix())
+	}
+	// Other fields come through untouched, & included
+	if epoch["access_count"] != float64(12) || !strings.Contains(response.Body, `"https://example.com/?a=1&b=2"`) {
+		t.Fatalf("epoch body = %s", response.Body)
+	}
+
+	if response := serve(t, newRequest("GET", "/api/times01?time_format=unix", "")); response.StatusCode != 400 {
+		t.Fatalf("unknown time_format = %d, want 400", response.StatusCode)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// dynamoDBTimeout bounds every DynamoDB call so a hung request fails fast
+// instead of holding the Lambda until the platform timeout
+var dynamoDBTimeout = time.Duration(envInt("DYNAMODB_TIMEOUT_MS", 3000)) * time.Millisecond
+
+// timeoutClient wraps a DynamoDBAPI and gives each call its own deadline
+type timeoutClient struct {
+	next    DynamoDBAPI
+	timeout time.Duration
+}
+
+// withTimeout returns client with a per-call deadline of timeout
+func withTimeout(client DynamoDBAPI, timeout time.Duration) DynamoDBAPI {
+	return &timeoutClient{next: client, timeout: timeout}
+}
+
+func (c *timeoutClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.PutItem(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.GetItem(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.UpdateItem(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.DeleteItem(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.BatchWriteItem(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.BatchGetItem(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.Scan(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.Query(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.DescribeTable(ctx, params, optFns...)
+}
+
+func (c *timeoutClient) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.CreateTable(ctx, params, optFns...)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHungDynamoDBCallReturns504(t *testing.T) {
+	db := newFakeDB()
+	db.before = func(ctx context.Context, op string, input any) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	setVar(t, &ddbClient, withTimeout(db, 20*time.Millisecond))
+
+	start := time.Now()
+	response := serve(t, newRequest("GET", "/abc1234", ""))
+	if response.StatusCode != 504 {
+		t.Fatalf("status = %d, want 504", response.StatusCode)
+	}
+	var body map[string]string
+	decode(t, response, &body)
+	if body["error"] == "" {
+		t.Fatalf("body %s has no error", response.Body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request took %v despite a 20ms timeout", elapsed)
+	}
+}
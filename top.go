@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	defaultTopLinks = 10  // Links returned when ?n is absent
+	maxTopLinks     = 100 // Upper bound on ?n
+	rankKeyPrefix   = "all"
+	rankShards      = 10 // Partitions the top links GSI is spread over
+)
+
+// topLinksIndex is a GSI with rank_key as the hash key and access_count as the
+// range key. Mappings are spread over rankShards rank_key values so no single
+// partition takes every click, and the rankings query each shard and merge.
+// When unset the table is scanned and sorted instead.
+var topLinksIndex = os.Getenv("TOP_LINKS_INDEX")
+
+// newRankKey picks the top links GSI shard for a new mapping
+func newRankKey() string {
+	return fmt.Sprintf("%s#%d", rankKeyPrefix, rand.IntN(rankShards))
+}
+
+// rankKeys lists every shard of the top links GSI, plus the unsharded key
+// that mappings created before sharding still carry
+func rankKeys() []string {
+	keys := []string{rankKeyPrefix}
+	for shard := range rankShards {
+		keys = append(keys, fmt.Sprintf("%s#%d", rankKeyPrefix, shard))
+	}
+	return keys
+}
+
+// TopLink is one entry in the top links report
+type TopLink struct {
+	ShortURL    string `json:"short_url" dynamodbav:"short_url"`
+	LongURL     string `json:"long_url" dynamodbav:"long_url"`
+	AccessCount int    `json:"access_count" dynamodbav:"access_count"`
+}
+
+// TopLinksResponse is the body of GET /api/stats/top
+type TopLinksResponse struct {
+	Links []TopLink `json:"links"`
+}
+
+// getTopLinks handles GET /api/stats/top requests
+// It returns the ?n most-clicked links, capped at maxTopLinks
+func getTopLinks(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	n := defaultTopLinks
+	if raw := request.QueryStringParameters["n"]; raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return errorResponse(400, "n must be a positive integer"), nil
+		}
+		n = min(parsed, maxTopLinks)
+	}
+
+	var links []TopLink
+	var err error
+	if topLinksIndex != "" {
+		links, err = queryTopLinks(ctx, n)
+	} else {
+		links, err = scanTopLinks(ctx, n)
+	}
+	if err != nil {
+		return errorResponse(500, "Error querying DynamoDB"), err
+	}
+	if links == nil {
+		links = []TopLink{}
+	}
+	return jsonResponse(200, TopLinksResponse{Links: links})
+}
+
+// queryTopLinks reads the n busiest links from each shard of the access
+// count GSI and keeps the n busiest overall
+func queryTopLinks(ctx context.Context, n int) ([]TopLink, error) {
+	var links []TopLink
+	for _, rankKey := range rankKeys() {
+		result, err := ddbClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              &tableName,
+			IndexName:              &topLinksIndex,
+			KeyConditionExpression: aws.String("rank_key = :r"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":r": &types.AttributeValueMemberS{Value: rankKey},
+			},
+			ScanIndexForward: aws.Bool(false), // Highest access_count first
+			Limit:            aws.Int32(int32(n)),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var shard []TopLink
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &shard); err != nil {
+			return nil, err
+		}
+		links = append(links, shard...)
+	}
+	return busiestLinks(links, n), nil
+}
+
+// scanTopLinks scans the whole table and keeps the n busiest links
+func scanTopLinks(ctx context.Context, n int) ([]TopLink, error) {
+	var links []TopLink
+	paginator := dynamodb.NewScanPaginator(ddbClient, &dynamodb.ScanInput{
+		TableName:            &tableName,
+		ProjectionExpression: aws.String("short_url, long_url, access_count"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var batch []TopLink
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, err
+		}
+		links = append(links, batch...)
+	}
+	return busiestLinks(links, n), nil
+}
+
+// busiestLinks sorts links by access count and keeps the first n.
+// Ties are broken by code so the order is stable between calls.
+func busiestLinks(links []TopLink, n int) []TopLink {
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].AccessCount != links[j].AccessCount {
+			return links[i].AccessCount > links[j].AccessCount
+		}
+		return links[i].ShortURL < links[j].ShortURL
+	})
+	if len(links) > n {
+		links = links[:n]
+	}
+	return links
+}
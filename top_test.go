@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTopLinks(t *testing.T) {
+	for _, index := range []string{"top-links-index", ""} {
+		t.Run("index "+index, func(t *testing.T) {
+			setVar(t, &topLinksIndex, index)
+			db := useFakeDB(t)
+			// Links created before sharding keep the unsharded key and still rank
+			rankKeys := []string{rankKeyPrefix + "#0", rankKeyPrefix + "#3", rankKeyPrefix, rankKeyPrefix + "#3"}
+			for i, count := range []int{5, 50, 0, 12} {
+				seedLink(t, db, URLMapping{ShortURL: fmt.Sprintf("code%03d", i), LongURL: "https://example.com",
+					AccessCount: count, RankKey: rankKeys[i]})
+			}
+
+			var top TopLinksResponse
+			response := serve(t, withAPIKey(newRequest("GET", "/api/stats/top?n=3", "")))
+			decode(t, response, &top)
+			var got []string
+			for _, link := range top.Links {
+				got = append(got, fmt.Sprintf("%s=%d", link.ShortURL, link.AccessCount))
+			}
+			if want := "code001=50,code003=12,code000=5"; strings.Join(got, ",") != want {
+				t.Fatalf("top = %v, want %s", got, want)
+			}
+		})
+	}
+
+	t.Run("n is capped", func(t *testing.T) {
+		db := useFakeDB(t)
+		for i := 0; i < maxTopLinks+5; i++ {
+			seedLink(t, db, URLMapping{ShortURL: fmt.Sprintf("code%03d", i), LongURL: "https://example.com", AccessCount: i})
+		}
+		var top TopLinksResponse
+		decode(t, serve(t, withAPIKey(newRequest("GET", "/api/stats/top?n=1000", ""))), &top)
+		if len(top.Links) != maxTopLinks {
+			t.Fatalf("%d links, want %d", len(top.Links), maxTopLinks)
+		}
+	})
+
+	t.Run("needs a key", func(t *testing.T) {
+		useFakeDB(t)
+		if response := serve(t, newRequest("GET", "/api/stats/top", "")); response.StatusCode != 401 {
+			t.Fatalf("status = %d, want 401", response.StatusCode)
+		}
+	})
+}
+
+func TestNewLinksSpreadOverRankShards(t *testing.T) {
+	setVar(t, &topLinksIndex, "top-links-index")
+	db := useFakeDB(t)
+	shards := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		created := createLink(t, fmt.Sprintf(`{"long_url":"https://example.com/%d"}`, i))
+		rankKey := db.mapping(t, created.ShortURL).RankKey
+		if !strings.HasPrefix(rankKey, rankKeyPrefix+"#") {
+			t.Fatalf("rank_key = %q, want a shard of %q", rankKey, rankKeyPrefix)
+		}
+		shards[rankKey] = true
+	}
+	if len(shards) < 2 {
+		t.Fatalf("50 links landed in %d shard, want them spread out", len(shards))
+	}
+
+	var top TopLinksResponse
+	decode(t, serve(t, withAPIKey(newRequest("GET", "/api/stats/top?n=100", ""))), &top)
+	if len(top.Links) != 50 {
+		t.Fatalf("top has %d links, want all 50 across the shards", len(top.Links))
+	}
+}
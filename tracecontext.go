@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// W3C trace context (https://www.w3.org/TR/trace-context/) for tracing
+// systems other than X-Ray, such as OpenTelemetry. The incoming traceparent
+// is continued, or a new trace started, and passed on to outbound calls.
+
+// traceContextKey is the context key for the request's traceContext
+type traceContextKey struct{}
+
+// traceparentPattern matches a version 00 traceparent header
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// traceContext identifies this request's span within a trace
+type traceContext struct {
+	TraceID string
+	SpanID  string // This invocation's span; outbound calls name it as their parent
+	Flags   string
+	State   string // Vendor data from tracestate, passed on untouched
+}
+
+// newTraceContext continues the request's trace when it has a valid
+// traceparent header and starts a new one otherwise
+func newTraceContext(request events.APIGatewayProxyRequest) traceContext {
+	tc := traceContext{SpanID: randomHex(8), Flags: "01"}
+	m := traceparentPattern.FindStringSubmatch(strings.TrimSpace(headerValue(request, "traceparent")))
+	if m != nil && m[1] != strings.Repeat("0", 32) && m[2] != strings.Repeat("0", 16) {
+		tc.TraceID, tc.Flags = m[1], m[3]
+		tc.State = headerValue(request, "tracestate")
+		return tc
+	}
+	tc.TraceID = randomHex(16)
+	return tc
+}
+
+// traceparent is the header value naming this span as the parent
+func (tc traceContext) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%s", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// withTraceContext stores tc in the context for outbound calls further down
+func withTraceContext(ctx context.Context, tc traceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// setTraceHeaders adds the request's trace context to an outbound request
+func setTraceHeaders(ctx context.Context, req *http.Request) {
+	tc, ok := ctx.Value(traceContextKey{}).(traceContext)
+	if !ok {
+		return
+	}
+	req.Header.Set("traceparent", tc.traceparent())
+	if tc.State != "" {
+		req.Header.Set("tracestate", tc.State)
+	}
+}
+
+// randomHex returns n random bytes as lowercase hex
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
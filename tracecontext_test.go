@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	var mu sync.Mutex
+	var received []http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r.Header.Clone())
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+	setVar(t, &webhookClient, server.Client())
+
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "trace01", LongURL: "https://example.com", WebhookURL: server.URL})
+	var logs bytes.Buffer
+	setVar(t, &baseLogger, newJSONLogger(&logs))
+
+	send := func(traceparent string) http.Header {
+		t.Helper()
+		request := newRequest("GET", "/trace01", "")
+		if traceparent != "" {
+			request.Headers["traceparent"] = traceparent
+			request.Headers["tracestate"] = "vendor=abc"
+		}
+		serve(t, request)
+		mu.Lock()
+		defer mu.Unlock()
+		return received[len(received)-1]
+	}
+
+	header := send("00-" + traceID + "-" + parentID + "-01")
+	m := traceparentPattern.FindStringSubmatch(header.Get("traceparent"))
+	if m == nil || m[1] != traceID || m[2] == parentID || m[3] != "01" {
+		t.Fatalf("webhook traceparent = %q, want trace %s under a new span", header.Get("traceparent"), traceID)
+	}
+	if header.Get("tracestate") != "vendor=abc" {
+		t.Fatalf("webhook tracestate = %q", header.Get("tracestate"))
+	}
+	if !strings.Contains(logs.String(), `"trace_id":"`+traceID+`"`) || !strings.Contains(logs.String(), `"span_id":"`+m[2]+`"`) {
+		t.Fatalf("logs don't carry the trace: %s", logs.String())
+	}
+
+	// Without a usable traceparent a new trace is started
+	for _, incoming := range []string{"", "00-" + strings.Repeat("0", 32) + "-" + parentID + "-01", "garbage"} {
+		header := send(incoming)
+		m := traceparentPattern.FindStringSubmatch(header.Get("traceparent"))
+		if m == nil || m[1] == traceID || m[1] == strings.Repeat("0", 32) {
+			t.Fatalf("incoming %q: webhook traceparent = %q, want a new trace", incoming, header.Get("traceparent"))
+		}
+	}
+}
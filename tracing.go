@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-xray-sdk-go/xray"
+)
+
+// tracingEnabled is true when Lambda has active tracing on, which is when it
+// sets the X-Ray daemon address. Locally and in tests tracing is a no-op.
+var tracingEnabled = os.Getenv("AWS_XRAY_DAEMON_ADDRESS") != ""
+
+// startTrace opens a handler subsegment annotated with the method and short code.
+// The returned func closes it and must be called once the request is done.
+func startTrace(ctx context.Context, request events.APIGatewayProxyRequest) (context.Context, func(error)) {
+	if !tracingEnabled {
+		return ctx, func(error) {}
+	}
+
+	ctx, seg := xray.BeginSubsegment(ctx, "handler")
+	if seg == nil {
+		return ctx, func(error) {}
+	}
+	seg.AddAnnotation("method", request.HTTPMethod)
+	if shortURL := requestShortURL(request); shortURL != "" {
+		seg.AddAnnotation("short_code", shortURL)
+	}
+	return ctx, seg.Close
+}
+
+// tracingClient records each DynamoDB call as an X-Ray subsegment
+type tracingClient struct {
+	next DynamoDBAPI
+}
+
+// withTracing returns client with X-Ray subsegments around each call,
+// or client unchanged when tracing is off
+func withTracing(client DynamoDBAPI) DynamoDBAPI {
+	if !tracingEnabled {
+		return client
+	}
+	return &tracingClient{next: client}
+}
+
+func (c *tracingClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.PutItemOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.PutItem", func(ctx context.Context) error {
+		out, err = c.next.PutItem(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.GetItemOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.GetItem", func(ctx context.Context) error {
+		out, err = c.next.GetItem(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.UpdateItemOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.UpdateItem", func(ctx context.Context) error {
+		out, err = c.next.UpdateItem(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.DeleteItemOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.DeleteItem", func(ctx context.Context) error {
+		out, err = c.next.DeleteItem(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.BatchWriteItemOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.BatchWriteItem", func(ctx context.Context) error {
+		out, err = c.next.BatchWriteItem(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.BatchGetItemOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.BatchGetItem", func(ctx context.Context) error {
+		out, err = c.next.BatchGetItem(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.ScanOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.Scan", func(ctx context.Context) error {
+		out, err = c.next.Scan(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.QueryOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.Query", func(ctx context.Context) error {
+		out, err = c.next.Query(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.DescribeTableOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.DescribeTable", func(ctx context.Context) error {
+		out, err = c.next.DescribeTable(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *tracingClient) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (out *dynamodb.CreateTableOutput, err error) {
+	err = xray.Capture(ctx, "DynamoDB.CreateTable", func(ctx context.Context) error {
+		out, err = c.next.CreateTable(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
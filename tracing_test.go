@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-xray-sdk-go/xray"
+)
+
+func TestTracingClientDelegates(t *testing.T) {
+	setVar(t, &tracingEnabled, true)
+	db := newFakeDB()
+	client := withTracing(db)
+	if _, ok := client.(*tracingClient); !ok {
+		t.Fatalf("withTracing returned %T, want *tracingClient", client)
+	}
+
+	ctx, seg := xray.BeginSegment(context.Background(), "test")
+	defer seg.Close(nil)
+	item := map[string]types.AttributeValue{"short_url": &types.AttributeValueMemberS{Value: "abc1234"}}
+	if _, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("urls"), Item: item}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("urls"), Key: item})
+	if err != nil || out.Item == nil {
+		t.Fatalf("GetItem through the tracer = %v, %v", out, err)
+	}
+	if db.called("PutItem") != 1 || db.called("GetItem") != 1 {
+		t.Fatalf("fake saw %d PutItems and %d GetItems", db.called("PutItem"), db.called("GetItem"))
+	}
+
+	setVar(t, &tracingEnabled, false)
+	if withTracing(db) != DynamoDBAPI(db) {
+		t.Fatal("withTracing wrapped the client with tracing off")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// FieldError is one problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	status  int    // 403 for blocked destinations, 400 otherwise
+}
+
+// ValidationErrorResponse is the 400 body for a request with invalid fields.
+// Error repeats the first message for clients that only read the old shape.
+type ValidationErrorResponse struct {
+	Error  string       `json:"error"`
+	Errors []FieldError `json:"errors"`
+}
+
+// fieldErrors collects every validation problem with a request
+type fieldErrors []FieldError
+
+// add records a problem with field
+func (errs *fieldErrors) add(field, message string) {
+	*errs = append(*errs, FieldError{Field: field, Message: message, status: 400})
+}
+
+// addURL records a cleanLongURL error for field
+func (errs *fieldErrors) addURL(field string, err error) {
+	status := 400
+	if errors.Is(err, errBlockedDomain) {
+		status = 403
+	}
+	*errs = append(*errs, FieldError{Field: field, Message: longURLErrorMessage(err), status: status})
+}
+
+// response is the error response for the collected problems.
+// It is a 403 only when every problem is a blocked destination.
+func (errs fieldErrors) response() events.APIGatewayProxyResponse {
+	status := 403
+	for _, fieldErr := range errs {
+		if fieldErr.status != 403 {
+			status = 400
+		}
+	}
+	body, _ := json.Marshal(ValidationErrorResponse{Error: errs[0].Message, Errors: errs})
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
+}
+
+// validateCreateRequest checks every field of a create request, cleaning
+// URLs and other values in place, and returns all the problems it finds
+func validateCreateRequest(createReq *CreateURLRequest) fieldErrors {
+	var errs fieldErrors
+
+	// A missing or blank long_url would redirect to an empty Location
+	createReq.LongURL = strings.TrimSpace(createReq.LongURL)
+	if createReq.LongURL == "" && len(createReq.Destinations) > 0 {
+		createReq.LongURL = strings.TrimSpace(createReq.Destinations[0].URL)
+	}
+	if createReq.LongURL == "" {
+		errs.add("long_url", "long_url is required")
+	} else if cleaned, err := cleanLongURL(createReq.LongURL); err != nil {
+		errs.addURL("long_url", err)
+	} else {
+		createReq.LongURL = cleaned
+	}
+
+	if len(createReq.Destinations) > maxDestinations {
+		errs.add("destinations", fmt.Sprintf("at most %d destinations", maxDestinations))
+	}
+	for i := range createReq.Destinations {
+		destination := &createReq.Destinations[i]
+		field := fmt.Sprintf("destinations[%d]", i)
+		if destination.Weight < 1 || destination.Weight > maxDestinationWeight {
+			errs.add(field+".weight", fmt.Sprintf("destination weights must be between 1 and %d", maxDestinationWeight))
+		}
+		if cleaned, err := cleanLongURL(destination.URL); err != nil {
+			errs.addURL(field+".url", err)
+		} else {
+			destination.URL = cleaned
+		}
+	}
+
+	if len(createReq.GeoDestinations) > maxGeoDestinations {
+		errs.add("geo_destinations", fmt.Sprintf("at most %d geo_destinations", maxGeoDestinations))
+	}
+	geoDestinations := make(map[string]string, len(createReq.GeoDestinations))
+	for country, raw := range createReq.GeoDestinations {
+		field := "geo_destinations." + country
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !countryCodePattern.MatchString(country) {
+			errs.add(field, "geo_destinations keys must be two-letter country codes")
+			continue
+		}
+		if cleaned, err := cleanLongURL(raw); err != nil {
+			errs.addURL(field, err)
+		} else {
+			geoDestinations[country] = cleaned
+		}
+	}
+	createReq.GeoDestinations = geoDestinations
+
+	for field, deviceURL := range map[string]*string{"ios_url": &createReq.IOSURL, "android_url": &createReq.AndroidURL} {
+		if strings.TrimSpace(*deviceURL) == "" {
+			*deviceURL = ""
+			continue
+		}
+		if cleaned, err := cleanLongURL(*deviceURL); err != nil {
+			errs.addURL(field, err)
+		} else {
+			*deviceURL = cleaned
+		}
+	}
+
+	createReq.WebhookURL = strings.TrimSpace(createReq.WebhookURL)
+	if createReq.WebhookURL != "" {
+		if err := validateLongURL(createReq.WebhookURL); err != nil {
+			errs.addURL("webhook_url", err)
+		} else if !strings.HasPrefix(strings.ToLower(createReq.WebhookURL), "https://") {
+			errs.add("webhook_url", "webhook_url must use https")
+		}
+	}
+
+	createReq.Fragment = strings.TrimPrefix(strings.TrimSpace(createReq.Fragment), "#")
+	if len(createReq.Fragment) > maxFragmentBytes {
+		errs.add("fragment", fmt.Sprintf("fragment must be at most %d bytes", maxFragmentBytes))
+	}
+
+	if err := validateRedirectHeaders(createReq.RedirectHeaders); err != nil {
+		errs.add("redirect_headers", err.Error())
+	}
+
+	if createReq.RedirectCode != 0 && !allowedRedirectCodes[createReq.RedirectCode] {
+		errs.add("redirect_code", "redirect_code must be one of 301, 302, 307 or 308")
+	}
+
+	if createReq.MaxClicks < 0 {
+		errs.add("max_clicks", "max_clicks must not be negative")
+	}
+
+	if createReq.ExpiresInSeconds < 0 {
+		errs.add("expires_in_seconds", "expires_in_seconds must not be negative")
+	}
+
+	if createReq.CustomAlias != "" {
+		if err := validateCustomAlias(createReq.CustomAlias); err != nil {
+			errs.add("custom_alias", "invalid custom alias")
+		} else if strictAliasCharset && !inShortCodeAlphabet(canonicalCode(createReq.CustomAlias)) {
+			errs.add("custom_alias", fmt.Sprintf("custom alias may only use the characters %s", shortCodeAlphabet()))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidationErrorsNameEveryField(t *testing.T) {
+	db := useFakeDB(t)
+	response := serve(t, newRequest("POST", "/", `{"long_url":"not a url","custom_alias":"bad alias!"}`))
+
+	var body ValidationErrorResponse
+	decode(t, response, &body)
+	if response.StatusCode != 400 || len(body.Errors) != 2 {
+		t.Fatalf("response = %d %s", response.StatusCode, response.Body)
+	}
+	if body.Errors[0].Field != "long_url" || body.Errors[1].Field != "custom_alias" {
+		t.Fatalf("fields = %+v, want long_url then custom_alias", body.Errors)
+	}
+	if body.Error != body.Errors[0].Message || body.Errors[1].Message == "" {
+		t.Fatalf("messages = %q %+v", body.Error, body.Errors)
+	}
+	if db.totalCalls() != 0 {
+		t.Fatalf("invalid request made %d DynamoDB calls", db.totalCalls())
+	}
+}
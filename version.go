@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// router handles a request whose path has had any version prefix removed
+type router func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// apiVersions maps each /vN path prefix to the routes for that version.
+// Every version serves today's routes; a breaking change gets its own
+// router here while older versions keep theirs.
+var apiVersions = map[string]router{
+	"v1": routeRequest,
+	"v2": routeRequest,
+}
+
+// versionPattern matches a path segment that names an API version
+var versionPattern = regexp.MustCompile(`^v[0-9]+$`)
+
+// routeVersioned strips a /vN prefix and dispatches to that version's routes.
+// Paths without a prefix keep the unversioned routes. A lone /vN is left
+// alone, since it could be a short code. The path parameters are rebuilt
+// from the stripped path, because the API Gateway route that matched may
+// have bound the version to {tenant} or a greedy {proxy+} parameter.
+func routeVersioned(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	segments := pathSegments(request.Path)
+	if len(segments) < 2 || !versionPattern.MatchString(segments[0]) {
+		return routeRequest(ctx, request)
+	}
+
+	route, ok := apiVersions[segments[0]]
+	if !ok {
+		return errorResponse(404, "Unknown API version"), nil
+	}
+	request.Path = "/" + strings.Join(segments[1:], "/")
+	request.PathParameters = pathParameters(segments[1:])
+	return route(ctx, request)
+}
+
+// pathParameters derives the {tenant} and {shortURL} parameters the
+// unversioned routes bind: /api/{shortURL}/..., /{shortURL} and
+// /{tenant}/{shortURL}
+func pathParameters(segments []string) map[string]string {
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		return map[string]string{"shortURL": segments[1]}
+	case len(segments) == 1:
+		return map[string]string{"shortURL": segments[0]}
+	case len(segments) == 2:
+		return map[string]string{"tenant": segments[0], "shortURL": segments[1]}
+	}
+	return map[string]string{}
+}
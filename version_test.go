@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+
+	for _, path := range []string{"/v1/api/urls", "/v2/api/urls", "/api/urls"} {
+		response := serve(t, withAPIKey(newRequest("GET", path, "")))
+		var page ListURLsResponse
+		decode(t, response, &page)
+		if response.StatusCode != 200 || len(page.URLs) != 1 {
+			t.Fatalf("GET %s = %d %s", path, response.StatusCode, response.Body)
+		}
+	}
+	if response := serve(t, newRequest("GET", "/v1/abc1234", "")); response.StatusCode != 302 {
+		t.Fatalf("versioned redirect = %d, want 302", response.StatusCode)
+	}
+
+	response := serve(t, withAPIKey(newRequest("GET", "/v9/api/urls", "")))
+	var body map[string]string
+	decode(t, response, &body)
+	if response.StatusCode != 404 || body["error"] != "Unknown API version" {
+		t.Fatalf("/v9 = %d %s", response.StatusCode, response.Body)
+	}
+
+	t.Run("version-shaped names are reserved", func(t *testing.T) {
+		if response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","custom_alias":"V10"}`)); response.StatusCode != 400 {
+			t.Errorf("alias V10 = %d, want 400", response.StatusCode)
+		}
+		request := newRequest("POST", "/", `{"long_url":"https://example.com"}`)
+		request.Headers["x-tenant"] = "v22"
+		if response := serve(t, request); response.StatusCode != 400 {
+			t.Errorf("tenant v22 = %d, want 400", response.StatusCode)
+		}
+	})
+}
+
+func TestVersionedRoutesIgnoreGatewayPathParameters(t *testing.T) {
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "abc1234", LongURL: "https://example.com"})
+	seedLink(t, db, URLMapping{ShortURL: "acme/xyz1234", LongURL: "https://acme.example", Tenant: "acme"})
+
+	// Each request carries the parameters API Gateway binds for the route that matched
+	for _, tc := range []struct {
+		name   string
+		path   string
+		params map[string]string
+		status int
+		want   string
+	}{
+		{"tenant route", "/v1/abc1234", map[string]string{"tenant": "v1", "shortURL": "abc1234"}, 302, "https://example.com"},
+		{"greedy proxy", "/v2/api/abc1234", map[string]string{"proxy": "v2/api/abc1234"}, 200, `"short_url":"abc1234"`},
+		{"version parameter", "/v1/acme/xyz1234", map[string]string{"version": "v1", "shortURL": "acme"}, 302, "https://acme.example"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := newRequest("GET", tc.path, "")
+			request.PathParameters = tc.params
+			response := serve(t, request)
+			if response.StatusCode != tc.status || !strings.Contains(response.Headers["Location"]+response.Body, tc.want) {
+				t.Fatalf("GET %s = %d %s %s, want %d %s", tc.path, response.StatusCode, response.Headers["Location"], response.Body, tc.status, tc.want)
+			}
+		})
+	}
+}
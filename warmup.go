@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// warmupEvent holds the fields that mark a keep-alive ping: either an
+// EventBridge scheduled event or a custom {"warmup": true} payload.
+// Neither API Gateway payload format has these top-level fields.
+type warmupEvent struct {
+	Source     string `json:"source"`
+	DetailType string `json:"detail-type"`
+	Warmup     bool   `json:"warmup"`
+}
+
+// isWarmupEvent reports whether a raw Lambda payload is a keep-alive ping
+func isWarmupEvent(payload json.RawMessage) bool {
+	var event warmupEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return false
+	}
+	return event.Warmup || (event.Source == "aws.events" && event.DetailType == "Scheduled Event")
+}
+
+// withWarmup wraps a Lambda handler so keep-alive pings are answered before
+// the payload is decoded as an API Gateway event. Pings never reach the
+// router, so they can't create links, count clicks or set up the DynamoDB client.
+func withWarmup[T, R any](handler func(context.Context, T) (R, error)) func(context.Context, json.RawMessage) (any, error) {
+	return func(ctx context.Context, payload json.RawMessage) (any, error) {
+		if isWarmupEvent(payload) {
+			baseLogger.Debug("Warmup ping")
+			return events.APIGatewayProxyResponse{StatusCode: 200, Body: `{"status":"warm"}`}, nil
+		}
+
+		var request T
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestWarmupPingsSkipTheRouter(t *testing.T) {
+	db := useFakeDB(t)
+	handler := withWarmup(handleRequest)
+
+	for _, payload := range []string{
+		`{"source":"aws.events","detail-type":"Scheduled Event","detail":{}}`,
+		`{"warmup":true}`,
+	} {
+		out, err := handler(context.Background(), json.RawMessage(payload))
+		response, ok := out.(events.APIGatewayProxyResponse)
+		if err != nil || !ok || response.StatusCode != 200 {
+			t.Fatalf("%s = %#v, %v", payload, out, err)
+		}
+	}
+	if db.totalCalls() != 0 {
+		t.Fatalf("warmup pings made %d DynamoDB calls", db.totalCalls())
+	}
+
+	// A real request, even one posting a warmup-looking body, is routed as usual
+	raw, _ := json.Marshal(newRequest("POST", "/", `{"long_url":"https://example.com","warmup":true}`))
+	out, err := handler(context.Background(), raw)
+	if response, ok := out.(events.APIGatewayProxyResponse); err != nil || !ok || response.StatusCode != 201 {
+		t.Fatalf("API Gateway request = %#v, %v", out, err)
+	}
+	if db.called("PutItem") != 1 {
+		t.Fatalf("PutItem calls = %d, want 1", db.called("PutItem"))
+	}
+}
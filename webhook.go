@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds one webhook delivery; slow receivers just miss the event
+const webhookTimeout = 2 * time.Second
+
+// webhookClient delivers click webhooks. It refuses private addresses and
+// never follows redirects, so a link's creator can't point deliveries at
+// internal services, directly or by bouncing them.
+var webhookClient = &http.Client{
+	Timeout:   webhookTimeout,
+	Transport: publicOnlyTransport(),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// WebhookPayload is the JSON body POSTed to a link's webhook on each click
+type WebhookPayload struct {
+	ShortURL  string    `json:"short_url"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Referer   string    `json:"referer,omitempty"`
+}
+
+// notifyWebhook delivers a click to webhookURL in the background.
+// Failures are logged and dropped; there is no retry.
+func notifyWebhook(ctx context.Context, webhookURL string, click ClickEvent) {
+	if webhookURL == "" {
+		return
+	}
+
+	goBackground(func() {
+		deliverCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookTimeout)
+		defer cancel()
+
+		if err := deliverWebhook(deliverCtx, webhookURL, click); err != nil {
+			loggerFrom(ctx).Warn("Webhook delivery failed", slog.String("short_code", click.ShortURL), slog.Any("error", err))
+		}
+	})
+}
+
+// deliverWebhook POSTs one click to webhookURL
+func deliverWebhook(ctx context.Context, webhookURL string, click ClickEvent) error {
+	body, err := json.Marshal(WebhookPayload{
+		ShortURL:  click.ShortURL,
+		ClickedAt: click.ClickedAt,
+		Referer:   click.Referer,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setTraceHeaders(ctx, req)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
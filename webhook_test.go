@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClickWebhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads []WebhookPayload
+		status   = 204
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&payload) != nil {
+			t.Errorf("webhook got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		payloads = append(payloads, payload)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	setVar(t, &webhookClient, server.Client())
+
+	db := useFakeDB(t)
+	seedLink(t, db, URLMapping{ShortURL: "hook001", LongURL: "https://example.com", WebhookURL: server.URL + "/clicks"})
+
+	request := newRequest("GET", "/hook001", "")
+	request.Headers["Referer"] = "https://news.example"
+	if response := serve(t, request); response.StatusCode != 302 {
+		t.Fatalf("redirect = %d", response.StatusCode)
+	}
+	mu.Lock()
+	if len(payloads) != 1 || payloads[0].ShortURL != "hook001" || payloads[0].Referer != "https://news.example" || payloads[0].ClickedAt.IsZero() {
+		t.Fatalf("payloads = %+v", payloads)
+	}
+	// A failing receiver doesn't change the redirect
+	status = 500
+	mu.Unlock()
+	if response := serve(t, newRequest("GET", "/hook001", "")); response.StatusCode != 302 {
+		t.Fatalf("redirect with a failing webhook = %d", response.StatusCode)
+	}
+
+	t.Run("only https webhooks", func(t *testing.T) {
+		response := serve(t, newRequest("POST", "/", `{"long_url":"https://example.com","webhook_url":"http://hooks.example/clicks"}`))
+		if response.StatusCode != 400 {
+			t.Fatalf("http webhook = %d, want 400", response.StatusCode)
+		}
+	})
+	t.Run("private address", func(t *testing.T) {
+		setVar(t, &allowPrivateHosts, false)
+		setVar(t, &webhookClient, &http.Client{Transport: publicOnlyTransport()})
+		err := deliverWebhook(context.Background(), server.URL+"/clicks", ClickEvent{ShortURL: "hook001", ClickedAt: time.Now()})
+		if !errors.Is(err, errPrivateHost) {
+			t.Fatalf("delivery = %v, want errPrivateHost", err)
+		}
+	})
+	t.Run("never returned", func(t *testing.T) {
+		response := serve(t, newRequest("GET", "/api/hook001", ""))
+		if strings.Contains(response.Body, server.URL) {
+			t.Fatalf("metadata leaks the webhook URL: %s", response.Body)
+		}
+	})
+}